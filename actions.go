@@ -0,0 +1,263 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// survivor splits the group in the file to keep and its duplicates.
+// The file to keep is the first one of the group, unless a file has
+// been selected (--follow-first-only).
+func (g ResultSet) survivor() (keep string, dupes []string) {
+	if g.Keep == "" {
+		return g.Paths[0], g.Paths[1:]
+	}
+	for _, p := range g.Paths {
+		if p != g.Keep {
+			dupes = append(dupes, p)
+		}
+	}
+	return g.Keep, dupes
+}
+
+// keepCandidate selects the file to keep in a sorted duplicate list,
+// according to the keep policies.  Files on a fast device (--fast-device)
+// are preferred; then the first file found (--follow-first-only) or the
+// oldest created file (--keep-oldest-created) is selected.
+func (data *dataT) keepCandidate(l FileObjList, options Options) *fileObj {
+	candidates := l
+	if data.fastDevices != nil {
+		var fast FileObjList
+		for _, fo := range l {
+			if dev, _ := GetDevIno(fo); data.fastDevices[dev] {
+				fast = append(fast, fo)
+			}
+		}
+		if len(fast) > 0 {
+			candidates = fast
+		}
+	}
+	keep := candidates[0]
+	if options.FollowFirstOnly {
+		keep = candidates.firstWalked()
+	} else if options.KeepOldestCreated {
+		if fo := candidates.oldestCreated(); fo != nil {
+			keep = fo
+		}
+	}
+	return keep
+}
+
+// chooseKeep returns the path of the file to keep (see keepCandidate).
+// An empty string is returned if the first file of the list is kept.
+func (data *dataT) chooseKeep(l FileObjList, options Options) string {
+	keep := data.keepCandidate(l, options)
+	if keep == l[0] && !options.FollowFirstOnly && !options.KeepOldestCreated {
+		return ""
+	}
+	return keep.FilePath
+}
+
+// shellQuote quotes a string so that it can be safely used as a single
+// argument in a POSIX shell command line.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// expandExecTemplate builds the command arguments for the group.
+// "{keep}" is replaced with the file to keep and "{dupes...}" with the
+// list of its duplicates.
+func expandExecTemplate(template []string, g ResultSet) []string {
+	keep, dupes := g.survivor()
+	var args []string
+	for _, a := range template {
+		switch a {
+		case "{keep}":
+			args = append(args, keep)
+		case "{dupes...}":
+			args = append(args, dupes...)
+		default:
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// expandExecShellTemplate builds a shell command line for the group,
+// with the placeholders replaced with quoted paths.
+func expandExecShellTemplate(template string, g ResultSet) string {
+	keep, dupes := g.survivor()
+	var quotedDupes []string
+	for _, d := range dupes {
+		quotedDupes = append(quotedDupes, shellQuote(d))
+	}
+	cmdline := strings.Replace(template, "{keep}", shellQuote(keep), -1)
+	return strings.Replace(cmdline, "{dupes...}",
+		strings.Join(quotedDupes, " "), -1)
+}
+
+// execGroups runs the command template once for every duplicate group.
+// Unconfirmed groups (--fast-match) are skipped.
+// If useShell is true, the command line is run with "sh -c".
+func execGroups(results Results, template string, useShell bool) error {
+	tmplArgs := strings.Fields(template)
+	if len(tmplArgs) == 0 {
+		return errors.New("empty command template")
+	}
+
+	var failures int
+	for _, g := range results.Groups {
+		if g.Unconfirmed {
+			continue // Never act on unconfirmed duplicates
+		}
+		var cmd *exec.Cmd
+		if useShell {
+			cmd = exec.Command("sh", "-c",
+				expandExecShellTemplate(template, g))
+		} else {
+			args := expandExecTemplate(tmplArgs, g)
+			cmd = exec.Command(args[0], args[1:]...)
+		}
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		myLog.Println(2, "Running", cmd.Args)
+		if err := cmd.Run(); err != nil {
+			myLog.Println(-1, "Command failed for", g.Paths[0], "-", err)
+			failures++
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("command failed for %d groups", failures)
+	}
+	return nil
+}
+
+// dirGuard keeps track of the number of entries left in directories, so
+// that the last file of a directory is not removed (--script-keep-dirs).
+type dirGuard map[string]int
+
+// allowRemoval returns true if the file is not the last entry of its
+// directory, and updates the directory entry count.
+func (dg dirGuard) allowRemoval(path string) bool {
+	dir := filepath.Dir(path)
+	n, ok := dg[dir]
+	if !ok {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+		n = len(entries)
+	}
+	if n <= 1 {
+		dg[dir] = n
+		return false
+	}
+	dg[dir] = n - 1
+	return true
+}
+
+// writeDeletionScript writes a shell script removing the duplicates of
+// every group, except the first file of each group.
+// Unconfirmed groups (--fast-match) are skipped.
+// If keepDirs is true, files which are the last entry of their directory
+// are not removed.
+// If untilFree is not zero, the groups wasting the most space are processed
+// first, and the script stops removing files once this amount of data has
+// been reclaimed.
+func writeDeletionScript(results Results, filename string, keepDirs bool, untilFree uint64) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+
+	order := make([]int, len(results.Groups))
+	for i := range order {
+		order[i] = i
+	}
+	if untilFree > 0 {
+		waste := func(g ResultSet) uint64 {
+			return g.FileSize * uint64(len(g.Paths)-1)
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return waste(results.Groups[order[i]]) > waste(results.Groups[order[j]])
+		})
+	}
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintln(w, "# Duplicate files removal script generated by goduf")
+	fmt.Fprintf(w, "# Redundant data size: %s\n",
+		formatSize(results.RedundantDataSizeBytes, false))
+	if untilFree > 0 {
+		fmt.Fprintf(w, "# Stopping after %s\n", formatSize(untilFree, false))
+	}
+	guard := make(dirGuard)
+	var freed uint64
+	for n, i := range order {
+		if untilFree > 0 && freed >= untilFree {
+			fmt.Fprintf(w, "\n# Target reached: %d groups left untouched\n",
+				len(order)-n)
+			break
+		}
+		g := results.Groups[i]
+		if g.Unconfirmed {
+			continue // Never remove unconfirmed duplicates
+		}
+		keep, dupes := g.survivor()
+		// Comments are quoted with Go syntax so that a newline in a
+		// path cannot end the comment line.
+		fmt.Fprintf(w, "\n# Group #%d (%d files * %v)\n", i+1,
+			len(g.Paths), formatSize(g.FileSize, true))
+		fmt.Fprintf(w, "# Keeping %s\n", strconv.Quote(keep))
+		for _, d := range dupes {
+			if untilFree > 0 && freed >= untilFree {
+				fmt.Fprintf(w, "# Keeping %s (target reached)\n",
+					strconv.Quote(d))
+				continue
+			}
+			if keepDirs && !guard.allowRemoval(d) {
+				fmt.Fprintf(w, "# Keeping %s (last file of its directory)\n",
+					strconv.Quote(d))
+				continue
+			}
+			fmt.Fprintf(w, "rm -- %s\n", shellQuote(d))
+			// Data is only reclaimed when the last link is removed
+			if len(g.Links[d]) == 0 {
+				freed += g.FileSize
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
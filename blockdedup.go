@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"crypto/sha1"
+	"io"
+	"os"
+	"sort"
+)
+
+// BlockDedupStats contains the results of a block-level analysis
+// (--block-dedup)
+type BlockDedupStats struct {
+	BlockSize             uint64         `json:"block_size"`              // Block size
+	TotalBlocks           uint64         `json:"total_blocks"`            // Number of blocks read
+	UniqueBlocks          uint64         `json:"unique_blocks"`           // Number of distinct blocks
+	TotalSizeBytes        uint64         `json:"total_size_bytes"`        // Size of the files
+	DeduplicatedSizeBytes uint64         `json:"deduplicated_size_bytes"` // Size of the distinct blocks
+	SharingFiles          []BlockSharing `json:"sharing_files,omitempty"` // Files sharing blocks
+}
+
+// BlockSharing tells how many blocks of a file can be found elsewhere
+type BlockSharing struct {
+	Path         string `json:"path"`
+	SharedBlocks uint64 `json:"shared_blocks"`
+	TotalBlocks  uint64 `json:"total_blocks"`
+}
+
+type blockHash [sha1.Size]byte
+
+// blockHashes reads the file and returns the checksum of each block.
+func (fo *fileObj) blockHashes(blockSize int) ([]blockHash, error) {
+	var hashes []blockHash
+	err := fo.readContents(fullChecksum, func(tmp *fileObj) error {
+		file, err := os.Open(tmp.FilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		defer releaseCache(file)
+		adviseSequential(file)
+
+		var list []blockHash
+		buf := make([]byte, blockSize)
+		r := tmp.reader(file)
+		for {
+			n, err := io.ReadFull(r, buf)
+			addBytesRead(fullChecksum, int64(n))
+			if n > 0 {
+				list = append(list, sha1.Sum(buf[:n]))
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				hashes = list
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// allFiles returns all the scanned files, with only one path for each
+// set of hard links.
+func (data *dataT) allFiles() FileObjList {
+	var list FileObjList
+	for _, fo := range data.sizeSingles {
+		list = append(list, fo)
+	}
+	for _, l := range data.sizeGroups {
+		list = append(list, *l...)
+	}
+
+	var files FileObjList
+	type devinode struct{ dev, ino uint64 }
+	seen := make(map[devinode]bool)
+	for _, fo := range list {
+		if err := fo.stat(); err != nil {
+			myLog.Println(0, "Error:", err)
+			continue
+		}
+		if OSHasInodes() {
+			dev, ino := GetDevIno(fo)
+			if seen[devinode{dev, ino}] {
+				continue
+			}
+			seen[devinode{dev, ino}] = true
+		}
+		files = append(files, fo)
+	}
+	sort.Sort(byFilePathName(files))
+	return files
+}
+
+// blockDedup computes the block-level deduplication statistics of the
+// scanned files.  The block checksums of all files are kept in memory.
+func (data *dataT) blockDedup(blockSize int) *BlockDedupStats {
+	stats := &BlockDedupStats{BlockSize: uint64(blockSize)}
+	blockCount := make(map[blockHash]uint64)
+	blockSizes := make(map[blockHash]uint64)
+	fileBlocks := make(map[string][]blockHash)
+
+	files := data.allFiles()
+	for _, fo := range files {
+		hashes, err := fo.blockHashes(blockSize)
+		if err != nil {
+			myLog.Println(0, "Error:", err)
+			continue
+		}
+		fileBlocks[fo.FilePath] = hashes
+		stats.TotalSizeBytes += uint64(fo.Size())
+		for i, h := range hashes {
+			blockCount[h]++
+			if _, ok := blockSizes[h]; !ok {
+				size := uint64(blockSize)
+				if i == len(hashes)-1 && fo.Size()%int64(blockSize) != 0 {
+					size = uint64(fo.Size() % int64(blockSize))
+				}
+				blockSizes[h] = size
+			}
+		}
+		stats.TotalBlocks += uint64(len(hashes))
+	}
+
+	stats.UniqueBlocks = uint64(len(blockCount))
+	for _, size := range blockSizes {
+		stats.DeduplicatedSizeBytes += size
+	}
+
+	for _, fo := range files {
+		hashes := fileBlocks[fo.FilePath]
+		var shared uint64
+		for _, h := range hashes {
+			if blockCount[h] > 1 {
+				shared++
+			}
+		}
+		if shared > 0 {
+			stats.SharingFiles = append(stats.SharingFiles, BlockSharing{
+				Path:         fo.FilePath,
+				SharedBlocks: shared,
+				TotalBlocks:  uint64(len(hashes)),
+			})
+		}
+	}
+	return stats
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import "hash/fnv"
+
+// bloomMinItems is the minimal list size for which we use a bloom filter
+// to discard unique checksums before building the checksum map.
+const bloomMinItems = 10000
+
+const bloomBitsPerItem = 10
+const bloomHashCount = 7
+
+// bloomFilter is a simple bloom filter for strings
+type bloomFilter struct {
+	bits []uint64
+	size uint64
+}
+
+func newBloomFilter(n int) *bloomFilter {
+	size := uint64(n*bloomBitsPerItem) | 63
+	return &bloomFilter{bits: make([]uint64, size/64+1), size: size}
+}
+
+// locations returns the bit positions for the key, using double hashing.
+func (b *bloomFilter) locations(key string) [bloomHashCount]uint64 {
+	var loc [bloomHashCount]uint64
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31
+	for i := range loc {
+		loc[i] = (h1 + uint64(i)*h2) % b.size
+	}
+	return loc
+}
+
+func (b *bloomFilter) add(key string) {
+	for _, l := range b.locations(key) {
+		b.bits[l/64] |= 1 << (l % 64)
+	}
+}
+
+// test returns false if the key has never been added to the filter.
+func (b *bloomFilter) test(key string) bool {
+	for _, l := range b.locations(key) {
+		if b.bits[l/64]&(1<<(l%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomCandidates computes the checksums of the files and returns a
+// filter containing the checksums seen at least twice (and possibly a
+// few other ones), so that the files with a unique checksum can be
+// discarded without using a map entry.
+// The failed slice tells which checksums could not be computed.
+func (fileList FileObjList) bloomCandidates(sType sumType) (candidates *bloomFilter, failed []bool) {
+	seen := newBloomFilter(len(fileList))
+	candidates = newBloomFilter(len(fileList))
+	failed = make([]bool, len(fileList))
+	for i, fo := range fileList {
+		if fo.failed {
+			failed[i] = true
+			continue
+		}
+		hash, err := fo.checksum(sType)
+		if err != nil {
+			data.checksumFailed(fo, err)
+			failed[i] = true
+			continue
+		}
+		if seen.test(hash) {
+			candidates.add(hash)
+		} else {
+			seen.add(hash)
+		}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// addCasePath records a scanned path for --detect-case-collisions.
+// With --normalize-unicode, names only differing by their Unicode
+// normalization form are considered as colliding as well.
+func (data *dataT) addCasePath(path string) {
+	key := path
+	if data.normalizeUnicode {
+		key = norm.NFC.String(key)
+	}
+	key = strings.ToLower(key)
+	for _, p := range data.casePaths[key] {
+		if p == path { // Already seen (overlapping roots)
+			return
+		}
+	}
+	data.casePaths[key] = append(data.casePaths[key], path)
+}
+
+// caseCollisions returns the sets of paths differing only by case.
+func (data *dataT) caseCollisions() [][]string {
+	var collisions [][]string
+	for _, paths := range data.casePaths {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			return pathLess(paths[i], paths[j])
+		})
+		collisions = append(collisions, paths)
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return pathLess(collisions[i][0], collisions[j][0])
+	})
+	return collisions
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"hash/adler32"
+	"io"
+	"os"
+	"sort"
+)
+
+// Number of additional samples for the content-defined partial checksum
+const cdcSamples = 4
+
+// partialCDC enables the content-defined partial checksums
+var partialCDC bool
+
+// partialChecksumCDC computes the file's partial SHA1 hash from the first
+// and last bytes and from a few samples in the middle of the file.
+// The sample offsets are derived from a weak hash of the first block, so
+// they are the same for identical files but differ between files with
+// different headers, which helps with formats using a common footer.
+func (fo *fileObj) partialChecksumCDC() error {
+	file, err := os.Open(fo.FilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	defer releaseCache(file)
+	hash := fo.newHash()
+	size := fo.Size()
+
+	readBlock := func(offset int64) error {
+		section := io.NewSectionReader(file, offset, medsumBytes)
+		n, err := io.CopyN(hash, fo.reader(section), medsumBytes)
+		addBytesRead(partialChecksum, n)
+		return err
+	}
+
+	// First block
+	first := make([]byte, medsumBytes)
+	n, err := io.ReadFull(fo.reader(file), first)
+	addBytesRead(partialChecksum, int64(n))
+	if err != nil {
+		return err
+	}
+	hash.Write(first)
+
+	// Samples from the middle of the file
+	// (minSizePartialChecksum ensures there is room for them)
+	seed := uint64(adler32.Checksum(first))
+	span := uint64(size - 3*medsumBytes)
+	offsets := make([]int64, cdcSamples)
+	for i := range offsets {
+		seed = seed*6364136223846793005 + 1442695040888963407
+		offsets[i] = medsumBytes + int64((seed>>16)%span)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for _, offset := range offsets {
+		if err := readBlock(offset); err != nil {
+			return err
+		}
+	}
+
+	// Last block
+	if err := readBlock(size - medsumBytes); err != nil {
+		return err
+	}
+
+	fo.PartialHash = hash.Sum(nil)
+
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+const compareBlockSize = 65536
+
+// compareMaxOpen is the maximum number of files compared at the same time;
+// larger groups are only confirmed by their checksums.
+const compareMaxOpen = 256
+
+// compareReaders is the maximum number of concurrent block reads
+const compareReaders = 8
+
+// compareContents reads all the files of the list in lockstep, block by
+// block, and splits the list into groups of files with identical contents.
+// Files are dropped (and closed) as soon as their contents differ from all
+// the other files, so that we do not need to read them entirely.
+func (fileList FileObjList) compareContents() foListList {
+	if len(fileList) > compareMaxOpen {
+		myLog.Printf(1, "Too many files (%d) for a byte-to-byte comparison, "+
+			"relying on the checksums\n", len(fileList))
+		return foListList{fileList}
+	}
+
+	type member struct {
+		fo     *fileObj
+		file   *os.File
+		buf    []byte
+		offset int64
+		n      int
+		err    error
+	}
+	closeAll := func(set []*member) {
+		for _, m := range set {
+			m.file.Close()
+		}
+	}
+
+	var members []*member
+	for _, fo := range fileList {
+		file, err := os.Open(fo.FilePath)
+		if err != nil {
+			myLog.Println(0, "Error:", err)
+			continue
+		}
+		members = append(members, &member{fo: fo, file: file,
+			buf: make([]byte, compareBlockSize)})
+	}
+
+	var dupeList foListList
+	candidates := [][]*member{members}
+	for len(candidates) > 0 {
+		set := candidates[0]
+		candidates = candidates[1:]
+		if len(set) < 2 {
+			closeAll(set)
+			continue
+		}
+
+		// Read the next block of the files concurrently
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, compareReaders)
+		for _, m := range set {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(m *member) {
+				defer wg.Done()
+				// The block is read at its offset, so that it
+				// can be read again by a retry.
+				var n int
+				err := m.fo.readContents(fullChecksum, func(tmp *fileObj) error {
+					section := io.NewSectionReader(m.file, m.offset, compareBlockSize)
+					var err error
+					n, err = io.ReadFull(tmp.reader(section), m.buf)
+					addBytesRead(fullChecksum, int64(n))
+					return err
+				})
+				if isReadTimeout(err) {
+					// The buffer may still be written
+					m.n, m.err = 0, err
+				} else {
+					m.n, m.err = n, err
+					m.offset += int64(n)
+				}
+				<-sem
+			}(m)
+		}
+		wg.Wait()
+
+		// Split the set according to the block contents
+		blocks := make(map[string][]*member)
+		var order []string
+		for _, m := range set {
+			if m.err != nil && m.err != io.EOF &&
+				m.err != io.ErrUnexpectedEOF {
+				myLog.Println(0, "Error:", m.err)
+				m.file.Close()
+				continue
+			}
+			key := string(m.buf[:m.n])
+			if _, ok := blocks[key]; !ok {
+				order = append(order, key)
+			}
+			blocks[key] = append(blocks[key], m)
+		}
+		for _, key := range order {
+			subset := blocks[key]
+			if len(subset) < 2 {
+				closeAll(subset)
+				continue
+			}
+			// Files with the same block have the same length, so
+			// they all have been entirely read if this block is short.
+			if subset[0].n == compareBlockSize {
+				candidates = append(candidates, subset)
+				continue
+			}
+			closeAll(subset)
+			var l FileObjList
+			for _, m := range subset {
+				l = append(l, m.fo)
+			}
+			dupeList = append(dupeList, l)
+		}
+	}
+	return dupeList
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadConfig sets the flags from a configuration file, unless they have
+// been set on the command line.
+// Each line contains an option name and its value ("name = value"), or a
+// boolean option name alone.  String values can be quoted, and lines
+// starting with '#' are comments.  Options which can be repeated can be
+// listed several times.
+func loadConfig(filename string) error {
+	setOnCmdLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setOnCmdLine[f.Name] = true
+	})
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value := line, "true"
+		if i := strings.Index(line, "="); i >= 0 {
+			name = strings.TrimSpace(line[:i])
+			value = strings.TrimSpace(line[i+1:])
+		}
+		if strings.HasPrefix(value, `"`) {
+			if value, err = strconv.Unquote(value); err != nil {
+				return fmt.Errorf("%s:%d: invalid string", filename, n)
+			}
+		}
+		if name == "config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown option %q", filename, n, name)
+		}
+		if setOnCmdLine[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, n, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+// crcBlockSize is the amount of data used for the CRC pre-filter
+const crcBlockSize = 4096
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// firstBlockCRC computes the CRC32-C of the beginning of the file.
+func (fo *fileObj) firstBlockCRC() (uint32, error) {
+	if ioBudgetExceeded() {
+		return 0, errIOBudget
+	}
+	var crc uint32
+	err := fo.readContents(partialChecksum, func(tmp *fileObj) error {
+		file, err := os.Open(tmp.FilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		buf := make([]byte, crcBlockSize)
+		n, err := io.ReadFull(tmp.reader(file), buf)
+		addBytesRead(partialChecksum, int64(n))
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		crc = crc32.Checksum(buf[:n], castagnoliTable)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return crc, nil
+}
+
+// splitByCRC splits the list of files with the same size according to
+// the CRC of their first block (--crc-prefilter).  Files with a unique
+// CRC are saved as unique files.
+func (fileList FileObjList) splitByCRC() foListList {
+	sort.Sort(ByInode(fileList))
+
+	crcs := make(map[uint32]FileObjList)
+	var order []uint32
+	for _, fo := range fileList {
+		crc, err := fo.firstBlockCRC()
+		if err != nil {
+			data.checksumFailed(fo, err)
+			continue
+		}
+		if _, ok := crcs[crc]; !ok {
+			order = append(order, crc)
+		}
+		crcs[crc] = append(crcs[crc], fo)
+	}
+
+	var lists foListList
+	for _, crc := range order {
+		l := crcs[crc]
+		if len(l) < 2 {
+			data.addUniqueFiles(l)
+			continue
+		}
+		lists = append(lists, l)
+	}
+	return lists
+}
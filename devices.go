@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// deviceList is a flag.Value for the list of allowed devices, given as
+// paths or "major:minor" numbers (--only-device)
+type deviceList []string
+
+func (d *deviceList) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *deviceList) Set(value string) error {
+	*d = append(*d, value)
+	return nil
+}
+
+// resolve returns the set of device IDs of the list.
+func (d deviceList) resolve() (map[uint64]bool, error) {
+	devices := make(map[uint64]bool)
+	for _, spec := range d {
+		if major, minor, ok := strings.Cut(spec, ":"); ok {
+			maj, err1 := strconv.ParseUint(major, 10, 32)
+			min, err2 := strconv.ParseUint(minor, 10, 32)
+			if err1 == nil && err2 == nil {
+				dev, ok := makeDev(uint32(maj), uint32(min))
+				if !ok {
+					return nil, errors.New("device numbers are not supported on this system")
+				}
+				devices[dev] = true
+				continue
+			}
+		}
+		// Not a device number, this should be a path
+		fi, err := os.Stat(spec)
+		if err != nil {
+			return nil, err
+		}
+		dev, _ := GetDevIno(fi)
+		devices[dev] = true
+	}
+	return devices, nil
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import "sort"
+
+// findMissing returns the files whose content cannot be found in the
+// reference tree (--diff-reference), which is the root refRoot.
+// A hard link into the reference tree counts as a copy, and files of the
+// reference tree are never listed.
+// Unique files must have been kept.
+func (data *dataT) findMissing(groups foListList, refRoot int) []string {
+	var missing []string
+	// inReference returns true if the file or one of its hard links is
+	// in the reference tree.
+	inReference := func(fo *fileObj) bool {
+		if fo.root == refRoot {
+			return true
+		}
+		for _, r := range data.linkRoots[fo.FilePath] {
+			if r == refRoot {
+				return true
+			}
+		}
+		return false
+	}
+	addMissing := func(fo *fileObj) {
+		missing = append(missing, fo.FilePath)
+		missing = append(missing, data.hardLinks[fo.FilePath]...)
+	}
+
+	for _, l := range groups {
+		var found bool
+		for _, fo := range l {
+			if inReference(fo) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		for _, fo := range l {
+			addMissing(fo)
+		}
+	}
+	for _, fo := range data.uniqueFiles {
+		if !inReference(fo) {
+			addMissing(fo)
+		}
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return pathLess(missing[i], missing[j])
+	})
+	return missing
+}
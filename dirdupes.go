@@ -0,0 +1,203 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DirGroup contains a group of directories with identical contents
+type DirGroup struct {
+	Size  uint64   `json:"size"`  // Size of the files of each directory
+	Paths []string `json:"paths"` // List of directory paths
+}
+
+// dirEntries is the contents of a directory: the tokens identifying the
+// contents of the files and subdirectories, by name
+type dirEntries struct {
+	entries map[string]string
+	size    uint64
+}
+
+// findDuplicateDirs looks for directories with the same files (same names
+// and same contents) and the same subdirectories, recursively.
+// The files of a duplicate group share the same content token, and every
+// file with a unique content gets its own token.  Only the top-most
+// duplicate directories are reported.
+func findDuplicateDirs(roots []string, groups foListList, uniqueFiles FileObjList, hardLinks map[string][]string) []DirGroup {
+	isRoot := make(map[string]bool)
+	for _, r := range roots {
+		isRoot[filepath.Clean(r)] = true
+	}
+
+	dirs := make(map[string]*dirEntries)
+	getDir := func(dir string) *dirEntries {
+		d, ok := dirs[dir]
+		if !ok {
+			d = &dirEntries{entries: make(map[string]string)}
+			dirs[dir] = d
+		}
+		return d
+	}
+	addFile := func(path, token string, size uint64) {
+		path = filepath.Clean(path)
+		dir := filepath.Dir(path)
+		d := getDir(dir)
+		d.entries[filepath.Base(path)] = token
+		// Register the parent directories, up to the root
+		for !isRoot[dir] {
+			d.size += size
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return
+			}
+			p := getDir(parent)
+			if _, ok := p.entries[filepath.Base(dir)]; !ok {
+				p.entries[filepath.Base(dir)] = ""
+			}
+			dir, d = parent, p
+		}
+		d.size += size
+	}
+	addFileAndLinks := func(fo *fileObj, token string, size uint64) {
+		addFile(fo.FilePath, token, size)
+		for _, l := range hardLinks[fo.FilePath] {
+			addFile(l, token, size)
+		}
+	}
+
+	for i, l := range groups {
+		token := fmt.Sprintf("g%d", i)
+		for _, fo := range l {
+			addFileAndLinks(fo, token, uint64(fo.Size()))
+		}
+	}
+	for _, fo := range uniqueFiles {
+		var size uint64
+		if fo.stat() == nil {
+			size = uint64(fo.Size())
+		}
+		addFileAndLinks(fo, "u:"+fo.FilePath, size)
+	}
+
+	// The entries which are neither duplicate nor unique files (files
+	// which could not be hashed or have been filtered out, special files,
+	// subdirectories without such files) get their own token, so that
+	// the directories containing them do not match other directories.
+	// Empty subdirectories share the same token.
+	for dir, d := range dirs {
+		list, err := os.ReadDir(dir)
+		if err != nil {
+			myLog.Println(0, "Error:", err)
+			d.entries[""] = "x:" + dir
+			continue
+		}
+		for _, e := range list {
+			if _, ok := d.entries[e.Name()]; ok {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			token := "x:" + path
+			if e.IsDir() {
+				if sub, err := os.ReadDir(path); err == nil && len(sub) == 0 {
+					token = "empty"
+				}
+			}
+			d.entries[e.Name()] = token
+		}
+	}
+
+	// Compute the directory signatures, deepest directories first
+	var dirList []string
+	for dir := range dirs {
+		dirList = append(dirList, dir)
+	}
+	depth := func(dir string) int {
+		return len(splitPath(dir))
+	}
+	sort.Slice(dirList, func(i, j int) bool {
+		return depth(dirList[i]) > depth(dirList[j])
+	})
+	signatures := make(map[string]string)
+	bySignature := make(map[string][]string)
+	for _, dir := range dirList {
+		d := dirs[dir]
+		var names []string
+		for name := range d.entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		hash := sha1.New()
+		for _, name := range names {
+			fmt.Fprintf(hash, "%q %q\n", name, d.entries[name])
+		}
+		sig := fmt.Sprintf("d:%x", hash.Sum(nil))
+		signatures[dir] = sig
+		bySignature[sig] = append(bySignature[sig], dir)
+		if parent := filepath.Dir(dir); parent != dir {
+			if p, ok := dirs[parent]; ok {
+				if _, ok := p.entries[filepath.Base(dir)]; ok {
+					p.entries[filepath.Base(dir)] = sig
+				}
+			}
+		}
+	}
+
+	// Build the groups, skipping the groups of directories whose parent
+	// directories are all duplicates as well
+	isDuplicate := func(dir string) bool {
+		return len(bySignature[signatures[dir]]) > 1
+	}
+	var dirGroups []DirGroup
+	for _, paths := range bySignature {
+		if len(paths) < 2 {
+			continue
+		}
+		var top bool
+		for _, dir := range paths {
+			parent := filepath.Dir(dir)
+			if isRoot[dir] || parent == dir || !isDuplicate(parent) {
+				top = true
+				break
+			}
+		}
+		if !top {
+			continue
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			return pathLess(paths[i], paths[j])
+		})
+		dirGroups = append(dirGroups, DirGroup{
+			Size:  dirs[paths[0]].size,
+			Paths: paths,
+		})
+	}
+	sort.Slice(dirGroups, func(i, j int) bool {
+		if dirGroups[i].Size != dirGroups[j].Size {
+			return dirGroups[i].Size < dirGroups[j].Size
+		}
+		return pathLess(dirGroups[i].Paths[0], dirGroups[j].Paths[0])
+	})
+	return dirGroups
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"os"
+	"unsafe"
+)
+
+// directIO is set when file reads should bypass the page cache.
+var directIO bool
+
+const directIOAlignment = 4096
+const directIOBufferSize = 1 << 20
+
+// alignedBuffer returns a buffer whose address is suitably aligned
+// for direct I/O.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directIOAlignment)
+	offset := int(uintptr(unsafe.Pointer(&buf[0])) & (directIOAlignment - 1))
+	if offset != 0 {
+		offset = directIOAlignment - offset
+	}
+	return buf[offset : offset+size : offset+size]
+}
+
+// openChecksumFile opens a file for a full checksum computation.
+// If direct I/O is requested and supported, the file is opened so
+// that the page cache is bypassed and direct is true.
+func openChecksumFile(path string) (file *os.File, direct bool, err error) {
+	if directIO {
+		if file, err = openDirect(path); err == nil {
+			return file, true, nil
+		}
+	}
+	file, err = os.Open(path)
+	return file, false, err
+}
+
+// releaseCache tells the kernel the file data will not be used again,
+// if direct I/O has been requested.
+func releaseCache(file *os.File) {
+	if directIO {
+		dropCache(file)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software
+// Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+// USA
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openDirect is not supported on this system.
+func openDirect(path string) (*os.File, error) {
+	return nil, errors.New("direct I/O is not supported")
+}
+
+// dropCache does nothing on this system.
+func dropCache(file *os.File) {
+}
+
+// adviseSequential does nothing on this system.
+func adviseSequential(file *os.File) {
+}
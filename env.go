@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables used as options
+const envPrefix = "GODUF_"
+
+// envName returns the name of the environment variable of a flag,
+// e.g. GODUF_MIN_SIZE for --min-size.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// loadEnv sets the flags from the GODUF_* environment variables, unless
+// they have been set on the command line.
+// Options which can be repeated can be given several values, one per line.
+func loadEnv() error {
+	setOnCmdLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setOnCmdLine[f.Name] = true
+	})
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || setOnCmdLine[f.Name] || err != nil {
+			return
+		}
+		for _, v := range strings.Split(value, "\n") {
+			if e := flag.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("%s: %v", envName(f.Name), e)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// envRoots returns the roots listed in the GODUF_ROOTS environment
+// variable, separated like the PATH entries.
+func envRoots() []string {
+	var roots []string
+	for _, r := range filepath.SplitList(os.Getenv(envPrefix + "ROOTS")) {
+		if r != "" {
+			roots = append(roots, r)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// newReferenceFile returns a file object for the --equal-to reference.
+func newReferenceFile(path string) (*fileObj, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, errors.New("not a regular file: " + path)
+	}
+	return &fileObj{FilePath: path, FileInfo: fi}, nil
+}
+
+// findEqualTo returns the paths of the scanned files identical to the
+// reference file.
+// Only the files with the same size have been kept by visit().
+func (data *dataT) findEqualTo(ref *fileObj) ([]string, error) {
+	var candidates FileObjList
+	if sgListP, ok := data.sizeGroups[ref.Size()]; ok {
+		candidates = *sgListP
+	} else if fo, ok := data.sizeSingles[ref.Size()]; ok {
+		candidates = FileObjList{fo}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	if err := ref.Sum(fullChecksum); err != nil {
+		return nil, err
+	}
+	refPath, _ := filepath.Abs(ref.FilePath)
+
+	var equalList []string
+	sort.Sort(byFilePathName(candidates))
+	for _, fo := range candidates {
+		if p, _ := filepath.Abs(fo.FilePath); p == refPath {
+			continue // This is the reference file itself
+		}
+		if err := fo.stat(); err != nil {
+			myLog.Println(0, "Error:", err)
+			continue
+		}
+		if err := fo.Sum(fullChecksum); err != nil {
+			if err != errIOBudget {
+				myLog.Println(0, "Error:", err)
+			}
+			continue
+		}
+		if bytes.Equal(fo.Hash, ref.Hash) {
+			equalList = append(equalList, fo.FilePath)
+		}
+	}
+	return equalList, nil
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// exportStore copies one file of each distinct content to the store
+// directory, named after its checksum.  It returns the number of files
+// written.
+func exportStore(dir string, groups foListList, uniqueFiles FileObjList) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	var representatives FileObjList
+	for _, l := range groups {
+		representatives = append(representatives, l[0])
+	}
+	representatives = append(representatives, uniqueFiles...)
+
+	var count int
+	for _, fo := range representatives {
+		if err := fo.stat(); err != nil {
+			myLog.Println(0, "Error:", err)
+			continue
+		}
+		if fo.Hash == nil && fo.Size() > 0 {
+			if err := fo.Sum(fullChecksum); err != nil {
+				if err != errIOBudget {
+					myLog.Println(0, "Error:", err)
+				}
+				continue
+			}
+		}
+		hash := FileObjList{fo}.hashString()
+		if hash == "" {
+			continue
+		}
+		target := filepath.Join(dir, hash)
+		if _, err := os.Lstat(target); err == nil {
+			continue // Already in the store
+		}
+		if err := copyFile(fo.FilePath, target); err != nil {
+			myLog.Println(0, "Error:", err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// copyFile copies the contents of src to a new file dst.
+// The file is written to a temporary name and renamed when complete.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// gitChangedFiles returns the modified and untracked files of the git
+// working tree containing root, limited to the root directory.
+func gitChangedFiles(root string) ([]string, error) {
+	cmd := exec.Command("git", "-C", root, "ls-files", "-z",
+		"--modified", "--others", "--exclude-standard")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files failed in %s: %v %s", root, err,
+			bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, name := range bytes.Split(out, []byte{0}) {
+		if len(name) == 0 || seen[string(name)] {
+			continue
+		}
+		seen[string(name)] = true
+		files = append(files, filepath.Join(root, filepath.FromSlash(string(name))))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// walkGitChanged calls walkFn for every changed file of the git working
+// tree (--git-changed), instead of walking the whole tree.
+// Deleted files are skipped.
+func walkGitChanged(root string, walkFn filepath.WalkFunc) error {
+	files, err := gitChangedFiles(root)
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		f, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err := walkFn(path, f, err); err != nil && err != filepath.SkipDir {
+			return err
+		}
+	}
+	return nil
+}
@@ -1 +1,8 @@
 module github.com/McKael/goduf
+
+go 1.18
+
+require (
+	golang.org/x/sys v0.15.0
+	golang.org/x/text v0.14.0
+)
@@ -31,3 +31,9 @@ func OSHasInodes() bool {
 func GetDevIno(fi os.FileInfo) (uint64, uint64) {
 	return 0, 0 // Not supported
 }
+
+// GetNlink returns the number of hard links of a given file.
+// This is not supported on Windows and Plan9.
+func GetNlink(fi os.FileInfo) uint64 {
+	return 1 // Not supported
+}
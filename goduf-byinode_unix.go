@@ -44,3 +44,8 @@ func GetDevIno(fi os.FileInfo) (uint64, uint64) {
 	ino := fi.Sys().(*syscall.Stat_t).Ino
 	return uint64(dev), uint64(ino)
 }
+
+// GetNlink returns the number of hard links of a given file.
+func GetNlink(fi os.FileInfo) uint64 {
+	return uint64(fi.Sys().(*syscall.Stat_t).Nlink)
+}
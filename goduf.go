@@ -38,11 +38,26 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
 )
 
 const medsumBytes = 128
 const minSizePartialChecksum = 49152 // Should be > 3*medsumBytes
 
+// exitTooFewFiles is the exit status used when fewer files than
+// expected have been scanned (--expect-min-files).
+const exitTooFewFiles = 3
+
+// exitAlert is the exit status used when the redundant data size exceeds
+// the --alert-over threshold.
+const exitAlert = 4
+
+var errTooFewFiles = errors.New("too few files")
+
 type sumType int
 
 const (
@@ -57,25 +72,161 @@ type Options struct {
 	OutToJSON   bool
 	SkipPartial bool
 	IgnoreEmpty bool
+	TwoPass     bool
+	ReportNew   bool
+	HashCmd     string
+	Unique      bool
+	IOBudget    sizeValue
+	Exec        string
+	ExecShell   bool
+
+	VerifyHardLinks   bool
+	OutToNDJSON       bool
+	Manifest          string
+	StreamCompare     bool
+	SortLocale        string
+	OldestNewest      bool
+	ReadTimeout       time.Duration
+	ReadRetries       uint
+	EqualTo           string
+	Known             string
+	Throttle          sizeValue
+	MinNlink          uint64
+	MaxNlink          uint64
+	Tree              bool
+	PartialCDC        bool
+	Sparse            bool
+	FollowFirstOnly   bool
+	Histogram         bool
+	CompactPaths      bool
+	DedupRealPath     bool
+	Script            string
+	DirDupes          bool
+	MatchRelPath      bool
+	Reverse           bool
+	ExportStore       string
+	DirectIO          bool
+	SampleRate        float64
+	Seed              int64
+	ExpectMinFiles    uint
+	OneLine           bool
+	CaseCollisions    bool
+	FastMatch         bool
+	Watch             time.Duration
+	IgnoreContent     string
+	IgnoreFile        string
+	GitChanged        bool
+	StableIDs         bool
+	NormalizeUnicode  bool
+	SeparateEmpty     bool
+	ListRedundant     bool
+	IncludeStreams    bool
+	HTML              string
+	ReportUnreadable  bool
+	GroupMemberSort   string
+	OnlyDevices       deviceList
+	FastDevices       deviceList
+	RecordParameters  bool
+	MaxGroupHash      uint
+	CommonPrefix      bool
+	Scope             bool
+	ShowCreated       bool
+	SkipHeader        sizeValue
+	SkipFooter        sizeValue
+	KeepOldestCreated bool
+	GroupSeparator    string
+	DiffReference     string
+	DiffReports       bool
+	NoteSymlinks      bool
+	MaxResults        uint
+	ShowAge           bool
+	BlockDedup        sizeValue
+	MergeRoots        bool
+	Stream            bool
+	BrokenSymlinks    bool
+	ScriptKeepDirs    bool
+	UntilFree         sizeValue
+	AlertOver         sizeValue
+	CRCPrefilter      bool
+	SQLScript         string
+	Xattrs            bool
 }
 
 // Results contains the results of the duplicates search
 type Results struct {
-	Groups                 []ResultSet `json:"groups"`                    // List of duplicate sets
-	Duplicates             uint        `json:"duplicates"`                // Number of duplicates
-	NumberOfSets           uint        `json:"number_of_sets"`            // Number of duplicate sets
-	RedundantDataSizeBytes uint64      `json:"redundant_data_size_bytes"` // Redundant data size
-	RedundantDataSizeHuman string      `json:"redundant_data_size_human"` // Same, human-readable
-	TotalFileCount         uint        `json:"total_file_count"`          // Total number of checked files
-	TotalSizeBytes         uint64      `json:"total_size_bytes"`          // Total size for checked files
-	TotalSizeHuman         string      `json:"total_size_human"`          // Same, human-readable
+	Groups                 []ResultSet `json:"groups"`                       // List of duplicate sets
+	Duplicates             uint        `json:"duplicates"`                   // Number of duplicates
+	NumberOfSets           uint        `json:"number_of_sets"`               // Number of duplicate sets
+	RedundantDataSizeBytes uint64      `json:"redundant_data_size_bytes"`    // Redundant data size
+	RedundantDataSizeHuman string      `json:"redundant_data_size_human"`    // Same, human-readable
+	TotalFileCount         uint        `json:"total_file_count"`             // Total number of checked files
+	TotalSizeBytes         uint64      `json:"total_size_bytes"`             // Total size for checked files
+	TotalSizeHuman         string      `json:"total_size_human"`             // Same, human-readable
+	DedupRatioPercent      float64     `json:"dedup_ratio_percent"`          // Redundant data size / total size
+	UniqueFiles            []string    `json:"unique_files,omitempty"`       // Files with a unique content
+	IOBudgetExceeded       bool        `json:"io_budget_exceeded,omitempty"` // Incomplete results
+
+	ManifestMatches []ManifestMatch  `json:"manifest_matches,omitempty"` // Files listed in the manifest
+	Roots           []string         `json:"roots,omitempty"`            // Scanned roots, if several
+	TimedOut        []string         `json:"timed_out,omitempty"`        // Files that could not be read in time
+	EqualTo         []string         `json:"equal_to,omitempty"`         // Copies of the --equal-to file
+	CaseCollisions  [][]string       `json:"case_collisions,omitempty"`  // Paths differing only by case
+	Missing         []string         `json:"missing,omitempty"`          // Files missing from the reference tree
+	BlockDedup      *BlockDedupStats `json:"block_dedup,omitempty"`      // Block-level analysis
+	BrokenSymlinks  []string         `json:"broken_symlinks,omitempty"`  // Dangling symbolic links
+	InodeCollisions [][]string       `json:"inode_collisions,omitempty"` // Same inode, different contents (--verify-hardlinks)
+	Suspected       []ResultSet      `json:"suspected,omitempty"`        // Unreadable files with the size of other files
+
+	Histogram []HistogramBucket `json:"histogram,omitempty"`  // Groups by number of copies
+	DirGroups []DirGroup        `json:"dir_groups,omitempty"` // Duplicate directories
+
+	Sampled *SampleEstimate `json:"sampled,omitempty"`  // Extrapolated figures (--sample-rate)
+	IO      *IOStats        `json:"io_stats,omitempty"` // Amount of data read
+
+	OmittedGroups uint `json:"omitted_groups,omitempty"` // Groups left out (--max-results)
+
+	EmptyGroups []ResultSet `json:"empty_groups,omitempty"` // Empty files (--separate-empty)
+
+	LargestDuplicate *LargestFile `json:"largest_duplicate,omitempty"` // Largest duplicated file
+
+	Parameters *ScanParameters `json:"parameters,omitempty"` // Invocation parameters (--record-parameters)
+}
+
+// LargestFile is the largest file found in the duplicate groups
+type LargestFile struct {
+	Path      string `json:"path"`
+	SizeBytes uint64 `json:"size_bytes"`
 }
 
 // ResultSet contains a group of identical duplicate files
 type ResultSet struct {
-	FileSize uint64              `json:"file_size"`       // Size of each item
-	Paths    []string            `json:"paths"`           // List of file paths
-	Links    map[string][]string `json:"links,omitempty"` // Existing hard links
+	FileSize uint64              `json:"file_size"`        // Size of each item
+	Base     string              `json:"base,omitempty"`   // Common directory (--json-compact-paths)
+	Paths    []string            `json:"paths"`            // List of file paths
+	Links    map[string][]string `json:"links,omitempty"`  // Existing hard links
+	New      []string            `json:"new,omitempty"`    // Files from the last root (--report-new)
+	Hash     string              `json:"-"`                // Content checksum
+	ModTimes []time.Time         `json:"-"`                // Modification time of each item
+	Oldest   string              `json:"oldest,omitempty"` // Least recently modified item
+	Newest   string              `json:"newest,omitempty"` // Most recently modified item
+	Roots    []int               `json:"roots,omitempty"`  // Root index of each item
+
+	Unconfirmed bool                `json:"unconfirmed,omitempty"` // Only partial checksums match (--fast-match)
+	Symlinks    map[string][]string `json:"symlinks,omitempty"`    // Symbolic links to the items (--note-symlinks)
+
+	XattrDiffers []string `json:"xattr_differs,omitempty"` // Items whose extended attributes differ from the first one
+
+	Keep string `json:"keep,omitempty"` // Item to keep (--follow-first-only)
+
+	StableID string `json:"stable_id,omitempty"` // Content-based group identifier (--stable-ids)
+
+	UnicodeVariants []string `json:"unicode_variants,omitempty"` // Items whose names only differ by Unicode normalization
+
+	PartiallySampled bool `json:"partially_sampled,omitempty"` // Some files of this size were not hashed (--max-group-hash)
+
+	Scope string `json:"scope,omitempty"` // Location of the items: same-dir, same-tree or scattered (--scope)
+
+	BirthTimes []time.Time `json:"birth_times,omitempty"` // Creation time of each item, zero if unknown (--show-created)
 }
 
 type fileObj struct {
@@ -85,6 +236,12 @@ type fileObj struct {
 	PartialHash []byte
 	Hash        []byte
 	needHash    sumType
+	root        int             // Index of the root directory
+	hashAlgo    hashFactory     // Hash algorithm, SHA1 if nil (--hash-for)
+	order       uint            // Position in the walk order
+	timedOut    bool            // The checksum computation has timed out
+	failed      bool            // A checksum could not be computed
+	abort       <-chan struct{} // Closed when the checksum is given up
 }
 
 // FileObjList is only exported so that we can have a sort interface on inodes.
@@ -95,9 +252,67 @@ type dataT struct {
 	totalSize   uint64
 	cmpt        uint
 	sizeGroups  map[int64]*FileObjList
+	sizeSingles map[int64]*fileObj
 	emptyFiles  FileObjList
 	ignoreCount int
 	hardLinks   map[string][]string
+	linkRoots   map[string][]int // Root index of each hard link
+	progress    progressT
+	currentRoot int
+	keepUnique  bool
+	uniqueFiles FileObjList
+
+	verifyHardLinks bool
+	inodeCollisions [][]string // Files with the same inode but different contents
+
+	streamCompare bool
+	fastMatch     bool // Do not confirm partial checksum matches
+	crcPrefilter  bool // Compare the CRC of the first block first
+
+	onlySize   bool // Only keep files of size wantedSize
+	wantedSize int64
+
+	minNlink, maxNlink uint64 // Link count filters (0 for no limit)
+	nlinkIgnoreCount   int
+
+	seenPaths map[string]bool // Canonical paths (--dedup-realpath)
+	seenCount int
+
+	roots        []string
+	matchRelPath bool // Only compare files with the same relative path
+
+	sampler *sampler // Random file selection (--sample-rate)
+
+	candidateSize uint64 // Size of the files to be checksummed
+
+	casePaths        map[string][]string // Paths by case-insensitive name
+	normalizeUnicode bool                // Compare names in the NFC form
+
+	ignoreContent      manifestT // Checksums of ignored files
+	ignoreContentCount uint
+
+	symlinks map[string][]string // Symbolic links by target (--note-symlinks)
+
+	onGroup func(FileObjList) // Called for each confirmed group (--stream)
+
+	reportBrokenSymlinks bool
+	brokenSymlinks       []string
+
+	ignoreRules     ignoreRules // Rules from the --ignore-file file
+	ignoreFileCount int
+
+	suspected map[int64][]string // Unreadable files by size (--report-unreadable)
+
+	releaseGroups bool          // Drop the groups once streamed
+	released      releasedStats // Figures of the dropped groups
+
+	devices           map[uint64]bool // Allowed devices (--only-device)
+	fastDevices       map[uint64]bool // Preferred devices for the kept files
+	deviceIgnoreCount int
+
+	maxGroupHash  uint           // Maximum number of files hashed per size group
+	sampledSizes  map[int64]bool // Sizes of the capped groups
+	unhashedCount uint
 }
 
 var data dataT
@@ -123,12 +338,32 @@ func visit(path string, f os.FileInfo, err error) error {
 		data.ignoreCount++
 		return nil
 	}
+	if data.ignoreRules != nil && data.ignoredByRules(path, f.IsDir()) {
+		if f.IsDir() {
+			myLog.Println(5, "Skipping ignored directory", path)
+			return filepath.SkipDir
+		}
+		myLog.Println(6, "Ignoring file matching the ignore file:", path)
+		data.ignoreFileCount++
+		return nil
+	}
+	if data.casePaths != nil {
+		data.addCasePath(path)
+	}
 	if f.IsDir() {
 		return nil
 	}
 
 	if mode := f.Mode(); mode&os.ModeType != 0 {
 		if mode&os.ModeSymlink != 0 {
+			if data.symlinks != nil {
+				data.addSymlink(path)
+			}
+			if data.reportBrokenSymlinks {
+				if _, err := os.Stat(path); err != nil {
+					data.brokenSymlinks = append(data.brokenSymlinks, path)
+				}
+			}
 			myLog.Println(6, "Ignoring symbolic link", path)
 		} else {
 			myLog.Println(0, "Ignoring special file", path)
@@ -137,31 +372,166 @@ func visit(path string, f os.FileInfo, err error) error {
 		return nil
 	}
 
+	if data.devices != nil {
+		if dev, _ := GetDevIno(f); !data.devices[dev] {
+			myLog.Println(6, "Ignoring file on another device:", path)
+			data.deviceIgnoreCount++
+			return nil
+		}
+	}
+
+	if !data.nlinkAllowed(f) {
+		myLog.Println(6, "Ignoring file with", GetNlink(f), "links:", path)
+		data.nlinkIgnoreCount++
+		return nil
+	}
+
+	if data.seenPaths != nil && data.alreadySeen(path) {
+		myLog.Println(5, "Ignoring already scanned file", path)
+		data.seenCount++
+		return nil
+	}
+
+	if data.onlySize && f.Size() != data.wantedSize {
+		return nil
+	}
+
+	if data.sampler != nil && !data.sampler.keep() {
+		return nil
+	}
+
 	data.cmpt++
 	data.totalSize += uint64(f.Size())
-	fo := &fileObj{FilePath: path, FileInfo: f}
-	if _, ok := data.sizeGroups[f.Size()]; !ok {
-		data.sizeGroups[f.Size()] = new(FileObjList)
+	data.addFile(path, f)
+	data.progress.walkProgress(data.cmpt)
+	return nil
+}
+
+// nlinkAllowed checks the link count of the file against the limits.
+func (data *dataT) nlinkAllowed(f os.FileInfo) bool {
+	if data.minNlink == 0 && data.maxNlink == 0 {
+		return true
 	}
-	*data.sizeGroups[f.Size()] = append(*data.sizeGroups[f.Size()], fo)
+	n := GetNlink(f)
+	if data.minNlink > 0 && n < data.minNlink {
+		return false
+	}
+	return data.maxNlink == 0 || n <= data.maxNlink
+}
+
+// alreadySeen returns true if the canonical path of the file has already
+// been seen, and remembers it otherwise.
+func (data *dataT) alreadySeen(path string) bool {
+	realPath, err := canonicalPath(path)
+	if err != nil {
+		myLog.Println(0, "Cannot resolve path:", err)
+		return false
+	}
+	if data.seenPaths[realPath] {
+		return true
+	}
+	data.seenPaths[realPath] = true
+	return false
+}
+
+// addFile adds the file to the size group for its size.
+// The first file of a given size is stored without its FileInfo in
+// data.sizeSingles, so that files with a unique size (usually the vast
+// majority) do not pin their metadata in memory.  The size group is
+// created when a second file with the same size is found.
+func (data *dataT) addFile(path string, f os.FileInfo) {
+	size := f.Size()
+	fo := &fileObj{FilePath: path, FileInfo: f, root: data.currentRoot,
+		order: data.cmpt}
+	if sgListP, ok := data.sizeGroups[size]; ok {
+		*sgListP = append(*sgListP, fo)
+		return
+	}
+	first, ok := data.sizeSingles[size]
+	if !ok {
+		fo.FileInfo = nil
+		data.sizeSingles[size] = fo
+		return
+	}
+	delete(data.sizeSingles, size)
+
+	// Promote the size group: we need the metadata of the first file again
+	sgListP := new(FileObjList)
+	if err := first.stat(); err != nil {
+		myLog.Println(-1, "Ignoring ", first.FilePath, " - ", err)
+		data.ignoreCount++
+	} else if first.Size() != size || !first.Mode().IsRegular() {
+		myLog.Println(-1, "Ignoring ", first.FilePath, " - file has changed")
+		data.ignoreCount++
+	} else {
+		*sgListP = append(*sgListP, first)
+	}
+	*sgListP = append(*sgListP, fo)
+	data.sizeGroups[size] = sgListP
+}
+
+// stat reads the metadata of a file object stored without its FileInfo
+// (see addFile).
+func (fo *fileObj) stat() error {
+	if fo.FileInfo != nil {
+		return nil
+	}
+	fi, err := os.Lstat(fo.FilePath)
+	if err != nil {
+		return err
+	}
+	fo.FileInfo = fi
 	return nil
 }
 
 // Checksum computes the file's complete SHA1 hash.
+// If an external hash command has been provided, it is used instead.
 func (fo *fileObj) Checksum() error {
-	file, err := os.Open(fo.FilePath)
+	if len(hashCommand) > 0 {
+		return fo.externalChecksum()
+	}
+	file, direct, err := openChecksumFile(fo.FilePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	hash := sha1.New()
-	if size, err := io.Copy(hash, file); size != fo.Size() || err != nil {
+	defer releaseCache(file)
+	if !direct {
+		adviseSequential(file)
+	}
+	hash := fo.newHash()
+	var size, read int64
+	if sparseFiles {
+		size, read, err = fo.sparseHash(hash, file)
+	} else if skipHeader > 0 || skipFooter > 0 {
+		offset, length := hashedRegion(fo.Size())
+		section := io.NewSectionReader(file, offset, length)
+		read, err = io.Copy(hash, fo.reader(section))
+		size = read + fo.Size() - length
+	} else if direct {
+		// Hide the file's WriterTo so that the aligned buffer is used
+		r := struct{ io.Reader }{fo.reader(file)}
+		size, err = io.CopyBuffer(hash, r, alignedBuffer(directIOBufferSize))
+		read = size
+	} else {
+		size, err = io.Copy(hash, fo.reader(file))
+		read = size
+	}
+	addBytesRead(fullChecksum, read)
+	if size != fo.Size() || err != nil {
 		if err == nil {
 			return errors.New("failed to read the whole file: " +
 				fo.FilePath)
 		}
 		return err
 	}
+	if includeStreams {
+		n, err := fo.hashNamedStreams(hash)
+		addBytesRead(fullChecksum, n)
+		if err != nil {
+			return err
+		}
+	}
 
 	fo.Hash = hash.Sum(nil)
 
@@ -170,16 +540,22 @@ func (fo *fileObj) Checksum() error {
 
 // partialChecksum computes the file's partial SHA1 hash (first and last bytes).
 func (fo *fileObj) partialChecksum() error {
+	if partialCDC {
+		return fo.partialChecksumCDC()
+	}
 	file, err := os.Open(fo.FilePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	hash := sha1.New()
+	defer releaseCache(file)
+	hash := fo.newHash()
 
 	// Read first bytes and last bytes from file
 	for i := 0; i < 2; i++ {
-		if _, err := io.CopyN(hash, file, medsumBytes); err != nil {
+		n, err := io.CopyN(hash, fo.reader(file), medsumBytes)
+		addBytesRead(partialChecksum, n)
+		if err != nil {
 			if err == nil {
 				const errmsg = "failed to read bytes from file: "
 				return errors.New(errmsg + fo.FilePath)
@@ -197,7 +573,30 @@ func (fo *fileObj) partialChecksum() error {
 }
 
 // Sum computes the file's SHA1 hash, partial or full according to sType.
+// An error is returned if the I/O budget has been exceeded or if the
+// computation times out.  Transient read errors can be retried.
 func (fo *fileObj) Sum(sType sumType) error {
+	if sType == noChecksum {
+		return nil
+	}
+	if ioBudgetExceeded() {
+		return errIOBudget
+	}
+	var partialHash, hash []byte
+	err := fo.readContents(sType, func(tmp *fileObj) error {
+		err := tmp.sum(sType)
+		partialHash, hash = tmp.PartialHash, tmp.Hash
+		return err
+	})
+	if isReadTimeout(err) {
+		return err
+	}
+	fo.PartialHash, fo.Hash = partialHash, hash
+	return err
+}
+
+// sum computes the requested checksum.
+func (fo *fileObj) sum(sType sumType) error {
 	if sType == partialChecksum {
 		return fo.partialChecksum()
 	} else if sType == fullChecksum {
@@ -219,6 +618,8 @@ func (data *dataT) dispCount() { // It this still useful?
 		c1 += len(*scListP)
 		c2++
 	}
+	c1 += len(data.sizeSingles)
+	c2 += len(data.sizeSingles)
 	c1b = len(data.emptyFiles)
 	if c1b > 0 {
 		s1 = fmt.Sprintf("+%d", c1b)
@@ -229,7 +630,7 @@ func (data *dataT) dispCount() { // It this still useful?
 
 // checksum returns the requested checksum as a string.
 // If the checksum has not been pre-computed, it is calculated now.
-func (fo fileObj) checksum(sType sumType) (string, error) {
+func (fo *fileObj) checksum(sType sumType) (string, error) {
 	var hbytes []byte
 	if sType == partialChecksum {
 		hbytes = fo.PartialHash
@@ -267,11 +668,21 @@ func computeSheduledChecksums(fileLists ...foListList) {
 	// Sort the list for better efficiency
 	sort.Sort(ByInode(bigFileList))
 
+	var total uint64
+	for _, fo := range bigFileList {
+		total += fo.scheduledBytes()
+	}
+	data.progress.startHashing(total)
+
 	// Compute checksums
 	for _, fo := range bigFileList {
+		if ioBudgetExceeded() {
+			break
+		}
 		if err := fo.Sum(fo.needHash); err != nil {
-			myLog.Println(0, "Error:", err)
+			data.checksumFailed(fo, err)
 		}
+		data.progress.hashProgress(fo.scheduledBytes())
 		fo.needHash = noChecksum
 	}
 }
@@ -282,6 +693,44 @@ func (fileList FileObjList) scheduleChecksum(sType sumType) {
 	}
 }
 
+// checksumFailed reports a checksum error.  Unreadable files are kept
+// as suspected duplicates if they have been requested.
+// The file is marked as failed so that it is skipped by the next passes.
+func (data *dataT) checksumFailed(fo *fileObj, err error) {
+	if err == errIOBudget || fo.failed {
+		return
+	}
+	fo.failed = true
+	myLog.Println(0, "Error:", err)
+	if data.suspected != nil && os.IsPermission(err) {
+		size := fo.Size()
+		data.suspected[size] = append(data.suspected[size], fo.FilePath)
+	}
+}
+
+// suspectedGroups returns the unreadable files by size, sorted by size.
+func (data *dataT) suspectedGroups() []ResultSet {
+	var groups []ResultSet
+	for size, list := range data.suspected {
+		var paths []string
+		seen := make(map[string]bool)
+		for _, p := range list {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			return pathLess(paths[i], paths[j])
+		})
+		groups = append(groups, ResultSet{FileSize: uint64(size), Paths: paths})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].FileSize < groups[j].FileSize
+	})
+	return groups
+}
+
 // findDupesChecksums splits the fileObj list into several lists with the
 // same sType hash.
 func (fileList FileObjList) findDupesChecksums(sType sumType, dryRun bool) foListList {
@@ -296,11 +745,36 @@ func (fileList FileObjList) findDupesChecksums(sType sumType, dryRun bool) foLis
 		fileList.scheduleChecksum(fullChecksum)
 		return append(dupeList, fileList)
 	}
+	// For huge lists, find the candidate partial checksums first
+	var candidates *bloomFilter
+	var failed []bool
+	if sType == partialChecksum && len(fileList) >= bloomMinItems {
+		candidates, failed = fileList.bloomCandidates(sType)
+	}
+
 	// Compute checksums
-	for _, fo := range fileList {
+	for i, fo := range fileList {
+		if fo.failed || (failed != nil && failed[i]) {
+			continue
+		}
 		hash, err := fo.checksum(sType)
 		if err != nil {
-			myLog.Println(0, "Error:", err)
+			data.checksumFailed(fo, err)
+			continue
+		}
+		if sType == fullChecksum && data.ignoreContent != nil {
+			if _, ok := data.ignoreContent[FileObjList{fo}.hashString()]; ok {
+				myLog.Println(5, "Ignoring file with a listed checksum:",
+					fo.FilePath)
+				data.ignoreContentCount++
+				continue
+			}
+		}
+		if candidates != nil && !candidates.test(hash) {
+			// This checksum is unique
+			if !dryRun {
+				data.addUniqueFiles(FileObjList{fo})
+			}
 			continue
 		}
 		hashes[hash] = append(hashes[hash], fo)
@@ -309,12 +783,25 @@ func (fileList FileObjList) findDupesChecksums(sType sumType, dryRun bool) foLis
 	// Let's de-dupe now...
 	for _, l := range hashes {
 		if len(l) < 2 {
+			if !dryRun {
+				data.addUniqueFiles(l)
+			}
 			continue
 		}
 		if sType == partialChecksum {
 			scheduleFull = append(scheduleFull, l)
+		} else if data.streamCompare {
+			// Confirm the checksums with a byte-to-byte comparison
+			for _, cl := range l.compareContents() {
+				if data.emitGroup(cl) {
+					dupeList = append(dupeList, cl)
+				}
+				myLog.Printf(5, "  . found %d new duplicates\n", len(cl))
+			}
 		} else { // full checksums -> we're done
-			dupeList = append(dupeList, l)
+			if data.emitGroup(l) {
+				dupeList = append(dupeList, l)
+			}
 			myLog.Printf(5, "  . found %d new duplicates\n", len(l))
 		}
 	}
@@ -332,6 +819,21 @@ func (fileList FileObjList) findDupesChecksums(sType sumType, dryRun bool) foLis
 	return dupeList
 }
 
+// capGroup limits the number of files of a size group to be hashed
+// (--max-group-hash).  The first files by path are kept.
+func (data *dataT) capGroup(l FileObjList) FileObjList {
+	if uint(len(l)) <= data.maxGroupHash {
+		return l
+	}
+	sort.Sort(byFilePathName(l))
+	skipped := uint(len(l)) - data.maxGroupHash
+	myLog.Printf(2, "  Only hashing %d of %d files of %d bytes\n",
+		data.maxGroupHash, len(l), l[0].Size())
+	data.sampledSizes[l[0].Size()] = true
+	data.unhashedCount += skipped
+	return l[:data.maxGroupHash]
+}
+
 // findDupes() uses checksums to find file duplicates
 func (data *dataT) findDupes(skipPartial bool) foListList {
 	var dupeList foListList
@@ -340,13 +842,39 @@ func (data *dataT) findDupes(skipPartial bool) foListList {
 	var scheduleFull foListList
 
 	for size, sgListP := range data.sizeGroups {
-		// We skip partial checksums for small files or if requested
-		if size > minSizePartialChecksum && !skipPartial {
-			sgListP.scheduleChecksum(partialChecksum)
-			schedulePartial = append(schedulePartial, *sgListP)
-		} else {
-			sgListP.scheduleChecksum(fullChecksum)
-			scheduleFull = append(scheduleFull, *sgListP)
+		lists := foListList{*sgListP}
+		if data.matchRelPath {
+			lists = data.splitByRelPath(*sgListP)
+		}
+		for _, l := range lists {
+			data.candidateSize += uint64(size) * uint64(len(l))
+		}
+		if data.crcPrefilter && size > minSizePartialChecksum && !skipPartial {
+			var filtered foListList
+			for _, l := range lists {
+				filtered = append(filtered, l.splitByCRC()...)
+			}
+			lists = filtered
+		}
+		if data.maxGroupHash > 0 {
+			for i, l := range lists {
+				lists[i] = data.capGroup(l)
+			}
+		}
+		if data.releaseGroups {
+			// The lists are only referenced by the schedules now
+			delete(data.sizeGroups, size)
+		}
+		for _, l := range lists {
+			l.selectHashAlgorithm()
+			// We skip partial checksums for small files or if requested
+			if size > minSizePartialChecksum && !skipPartial {
+				l.scheduleChecksum(partialChecksum)
+				schedulePartial = append(schedulePartial, l)
+			} else {
+				l.scheduleChecksum(fullChecksum)
+				scheduleFull = append(scheduleFull, l)
+			}
 		}
 	}
 
@@ -356,22 +884,129 @@ func (data *dataT) findDupes(skipPartial bool) foListList {
 		r := l.findDupesChecksums(partialChecksum, true) // dry-run
 		schedulePartial2 = append(schedulePartial2, r...)
 	}
+	if data.fastMatch {
+		// Partial checksum matches are reported without confirmation
+		for _, l := range schedulePartial2 {
+			if data.emitGroup(l) {
+				dupeList = append(dupeList, l)
+			}
+		}
+		schedulePartial, schedulePartial2 = nil, nil
+	}
 	computeSheduledChecksums(schedulePartial2)
-	for _, l := range schedulePartial {
+	schedulePartial2 = nil
+	for i, l := range schedulePartial {
 		r := l.findDupesChecksums(partialChecksum, false)
 		dupeList = append(dupeList, r...)
+		if data.releaseGroups {
+			schedulePartial[i] = nil
+		}
 	}
-	for _, l := range scheduleFull {
+	for i, l := range scheduleFull {
 		r := l.findDupesChecksums(fullChecksum, false)
 		dupeList = append(dupeList, r...)
+		if data.releaseGroups {
+			scheduleFull[i] = nil
+		}
 	}
 	return dupeList
 }
 
+// hashString returns the full checksum of the files of a duplicate list,
+// as a string.  An empty string is returned if it has not been computed.
+func (fileList FileObjList) hashString() string {
+	h := fileList[0].Hash
+	if len(hashCommand) > 0 {
+		return string(h)
+	}
+	if h == nil && fileList[0].Size() == 0 {
+		h = sha1.New().Sum(nil)
+	}
+	if h == nil {
+		return ""
+	}
+	return hex.EncodeToString(h)
+}
+
+// countInodes returns the number of distinct dev/inode pairs in the list,
+// i.e. the number of copies actually using disk space.
+// If the O.S. does not support inodes, the number of files is returned.
+func (fileList FileObjList) countInodes() int {
+	if !OSHasInodes() {
+		return len(fileList)
+	}
+	type devinode struct{ dev, ino uint64 }
+	devinodes := make(map[devinode]bool)
+	for _, fo := range fileList {
+		dev, ino := GetDevIno(fo)
+		devinodes[devinode{dev, ino}] = true
+	}
+	return len(devinodes)
+}
+
+// stableID returns an identifier of the group derived from the size and
+// checksum of its files, so that it does not change across runs.
+func (fileList FileObjList) stableID() string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%d:", fileList[0].Size())
+	if sum := fileList.hashString(); sum != "" {
+		h.Write([]byte(sum))
+	} else {
+		h.Write(fileList[0].PartialHash)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// oldestCreated returns the file of the list with the earliest creation
+// time, or nil if the creation time is not available for all files.
+func (fileList FileObjList) oldestCreated() *fileObj {
+	var oldest *fileObj
+	var oldestTime time.Time
+	for _, fo := range fileList {
+		bt, ok := GetBirthTime(fo.FilePath, fo)
+		if !ok {
+			return nil
+		}
+		if oldest == nil || bt.Before(oldestTime) {
+			oldest, oldestTime = fo, bt
+		}
+	}
+	return oldest
+}
+
+// firstWalked returns the file of the list found first during the walk.
+func (fileList FileObjList) firstWalked() *fileObj {
+	first := fileList[0]
+	for _, fo := range fileList[1:] {
+		if fo.order < first.order {
+			first = fo
+		}
+	}
+	return first
+}
+
+// addUniqueFiles saves files known to have a unique content, if they
+// have been requested.
+func (data *dataT) addUniqueFiles(fileList FileObjList) {
+	if data.keepUnique {
+		data.uniqueFiles = append(data.uniqueFiles, fileList...)
+	}
+}
+
 // dropEmptyFiles removes the empty files from the main map, since we don't
 // have to do any processing about them.
 // If ignoreEmpty is false, the empty file list is saved in data.emptyFiles.
 func (data *dataT) dropEmptyFiles(ignoreEmpty bool) (emptyCount int) {
+	if fo, ok := data.sizeSingles[0]; ok {
+		// There is only one empty file
+		delete(data.sizeSingles, 0)
+		if ignoreEmpty {
+			emptyCount = 1
+		} else {
+			data.addUniqueFiles(FileObjList{fo})
+		}
+		return
+	}
 	sgListP, ok := data.sizeGroups[0]
 	if ok == false {
 		return // no empty files
@@ -388,10 +1023,59 @@ func (data *dataT) dropEmptyFiles(ignoreEmpty bool) (emptyCount int) {
 	return
 }
 
+// isHardLink checks if fo, which has the same device and inode numbers as
+// primary, is really a hard link.
+// Unless hard link verification has been requested, we trust the inodes.
+// Otherwise, a sample of both files is compared (the partial checksum, or
+// the full checksum for small files) as some filesystems (e.g. overlays)
+// can expose different files with the same device and inode numbers.
+func (data *dataT) isHardLink(primary, fo *fileObj) bool {
+	if !data.verifyHardLinks {
+		return true
+	}
+	sType := fullChecksum
+	if fo.Size() > minSizePartialChecksum {
+		sType = partialChecksum
+	}
+	h1, err1 := primary.checksum(sType)
+	h2, err2 := fo.checksum(sType)
+	if err1 != nil || err2 != nil {
+		// We cannot tell; let's trust the inode numbers
+		myLog.Println(0, "Error: cannot verify hard link", fo.FilePath)
+		return true
+	}
+	if h1 != h2 {
+		data.addInodeCollision(primary.FilePath, fo.FilePath)
+		return false
+	}
+	return true
+}
+
+// addInodeCollision records files with the same device and inode numbers
+// but different contents.  A given pair is only reported once.
+func (data *dataT) addInodeCollision(path1, path2 string) {
+	for _, c := range data.inodeCollisions {
+		if c[0] == path1 && c[1] == path2 {
+			return
+		}
+	}
+	myLog.Println(1, "Warning: same inode but different contents:",
+		path1, path2)
+	data.inodeCollisions = append(data.inodeCollisions, []string{path1, path2})
+}
+
 // initialCleanup() removes files with unique size as well as hard links
 func (data *dataT) initialCleanup() (hardLinkCount, uniqueSizeCount int) {
+	// Files with a unique size have never been added to the size groups
+	uniqueSizeCount = len(data.sizeSingles)
+	for _, fo := range data.sizeSingles {
+		data.addUniqueFiles(FileObjList{fo})
+	}
+	data.sizeSingles = make(map[int64]*fileObj)
+
 	for s, sgListP := range data.sizeGroups {
 		if len(*sgListP) < 2 {
+			data.addUniqueFiles(*sgListP)
 			delete(data.sizeGroups, s)
 			uniqueSizeCount++
 			continue
@@ -413,20 +1097,25 @@ func (data *dataT) initialCleanup() (hardLinkCount, uniqueSizeCount int) {
 		// TODO: Should we also check for duplicate paths?
 		for {
 			type devinode struct{ dev, ino uint64 }
-			devinodes := make(map[devinode]string)
+			devinodes := make(map[devinode]*fileObj)
 			var hardLinkIndex int
 
 			for i, fo := range *sgListP {
 				dev, ino := GetDevIno(fo)
 				di := devinode{dev, ino}
-				if primaryPath, ok := devinodes[di]; ok {
+				if primary, ok := devinodes[di]; ok {
+					if !data.isHardLink(primary, fo) {
+						continue
+					}
 					hardLinkIndex = i
 					hardLinkCount++
 					hardlinksFound = true
+					primaryPath := primary.FilePath
 					data.hardLinks[primaryPath] = append(data.hardLinks[primaryPath], fo.FilePath)
+					data.linkRoots[primaryPath] = append(data.linkRoots[primaryPath], fo.root)
 					break
 				} else {
-					devinodes[di] = fo.FilePath
+					devinodes[di] = fo
 				}
 			}
 
@@ -443,6 +1132,7 @@ func (data *dataT) initialCleanup() (hardLinkCount, uniqueSizeCount int) {
 		// maybe we can remove it
 		if hardlinksFound {
 			if len(*sgListP) < 2 {
+				data.addUniqueFiles(*sgListP)
 				delete(data.sizeGroups, s)
 				uniqueSizeCount++
 				continue
@@ -452,52 +1142,320 @@ func (data *dataT) initialCleanup() (hardLinkCount, uniqueSizeCount int) {
 	return
 }
 
+// checkNestedRoots warns when a root directory is located inside another
+// one, since its files would be scanned twice.
+func checkNestedRoots(dirs []string) {
+	abs := make([]string, len(dirs))
+	for i, d := range dirs {
+		p, err := filepath.Abs(d)
+		if err != nil {
+			p = filepath.Clean(d)
+		}
+		abs[i] = p
+	}
+	for i := range abs {
+		for j := range abs {
+			if i == j {
+				continue
+			}
+			rel, err := filepath.Rel(abs[j], abs[i])
+			if err != nil || rel == ".." ||
+				strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if rel == "." {
+				if i > j {
+					myLog.Println(-1, "Warning: root", dirs[i],
+						"is the same as", dirs[j])
+				}
+				continue
+			}
+			myLog.Println(-1, "Warning: root", dirs[i],
+				"is inside", dirs[j], "- its files will be scanned twice")
+		}
+	}
+}
+
+// mergeRoots removes the roots resolving to the same location as another
+// root, or located inside another root.
+func mergeRoots(dirs []string) []string {
+	canon := make([]string, len(dirs))
+	for i, d := range dirs {
+		p, err := canonicalPath(d)
+		if err != nil {
+			p = filepath.Clean(d)
+		}
+		canon[i] = p
+	}
+	var merged []string
+	for i := range dirs {
+		keep := true
+		for j := range dirs {
+			if i == j {
+				continue
+			}
+			rel, err := filepath.Rel(canon[j], canon[i])
+			if err != nil || rel == ".." ||
+				strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if rel == "." && j > i {
+				continue // Keep the first occurrence
+			}
+			myLog.Println(0, "Merging root", dirs[i], "into", dirs[j])
+			keep = false
+			break
+		}
+		if keep {
+			merged = append(merged, dirs[i])
+		}
+	}
+	return merged
+}
+
 func duf(dirs []string, options Options) (Results, error) {
 	var verbose bool
 	if myLog.verbosity > 0 {
 		verbose = true
 	}
 
+	if options.MergeRoots {
+		dirs = mergeRoots(dirs)
+	}
+	if options.DiffReference != "" {
+		// The reference tree is scanned as the last root
+		dirs = append(dirs[:len(dirs):len(dirs)], options.DiffReference)
+	}
+	newRoot := len(dirs) - 1
+
+	// Start from a clean state, duf can be called several times (--watch)
+	data = dataT{}
+	timedOutFiles = nil
+	resetIOStats()
+
 	var results Results
 	data.sizeGroups = make(map[int64]*FileObjList)
+	data.sizeSingles = make(map[int64]*fileObj)
 	data.hardLinks = make(map[string][]string)
+	data.linkRoots = make(map[string][]int)
+	data.roots = dirs
+	data.matchRelPath = options.MatchRelPath
+	data.reportBrokenSymlinks = options.BrokenSymlinks
+	if options.NoteSymlinks {
+		data.symlinks = make(map[string][]string)
+	}
+	data.normalizeUnicode = options.NormalizeUnicode
+	if options.CaseCollisions {
+		data.casePaths = make(map[string][]string)
+	}
+	if options.SampleRate < 1 {
+		data.sampler = newSampler(options.SampleRate, options.Seed)
+	}
+	// With a manifest or for directories, we need all the files, not only the duplicates
+	data.keepUnique = options.Unique || options.Manifest != "" ||
+		options.DirDupes || options.ExportStore != "" ||
+		options.DiffReference != ""
+
+	var manifest manifestT
+	if options.Manifest != "" {
+		var err error
+		if manifest, err = loadManifest(options.Manifest); err != nil {
+			return results, fmt.Errorf("could not read manifest: %v", err)
+		}
+	}
+	data.minNlink, data.maxNlink = options.MinNlink, options.MaxNlink
+	if options.DedupRealPath {
+		data.seenPaths = make(map[string]bool)
+	}
+	data.verifyHardLinks = options.VerifyHardLinks
+	if options.ReportUnreadable {
+		data.suspected = make(map[int64][]string)
+	}
+	if options.MaxGroupHash > 0 {
+		data.maxGroupHash = options.MaxGroupHash
+		data.sampledSizes = make(map[int64]bool)
+	}
+	if len(options.OnlyDevices) > 0 {
+		var err error
+		if data.devices, err = options.OnlyDevices.resolve(); err != nil {
+			return results, fmt.Errorf("invalid device: %v", err)
+		}
+	}
+	if len(options.FastDevices) > 0 {
+		var err error
+		if data.fastDevices, err = options.FastDevices.resolve(); err != nil {
+			return results, fmt.Errorf("invalid fast device: %v", err)
+		}
+	}
+	data.streamCompare = options.StreamCompare
+	data.fastMatch = options.FastMatch
+	data.crcPrefilter = options.CRCPrefilter
+
+	var known manifestT
+	if options.Known != "" {
+		var err error
+		if known, err = loadManifest(options.Known); err != nil {
+			return results, fmt.Errorf("could not read known checksums: %v", err)
+		}
+	}
+
+	if options.Stream && !options.Summary {
+		data.onGroup = func(l FileObjList) {
+			groups := foListList{l}
+			if known != nil {
+				groups = groups.filterKnown(known)
+			}
+			if options.ReportNew {
+				groups = groups.filterNewDuplicates(newRoot)
+			}
+			for _, g := range groups {
+				displayStreamGroup(g)
+				if data.releaseGroups {
+					data.released.add(g)
+				}
+			}
+		}
+		// Confirmed groups can be dropped once displayed, unless
+		// they are needed to build the full results.
+		data.releaseGroups = options.Script == "" && options.SQLScript == "" &&
+			options.HTML == "" && options.Exec == "" &&
+			options.ExportStore == "" && !options.Histogram &&
+			options.MaxResults == 0
+	}
+
+	if options.IgnoreContent != "" {
+		var err error
+		if data.ignoreContent, err = loadManifest(options.IgnoreContent); err != nil {
+			return results, fmt.Errorf("could not read ignored checksums: %v", err)
+		}
+	}
+
+	if options.IgnoreFile != "" {
+		var err error
+		if data.ignoreRules, err = loadIgnoreFile(options.IgnoreFile); err != nil {
+			return results, fmt.Errorf("could not read ignore file: %v", err)
+		}
+	}
+
+	var refFile *fileObj
+	if options.EqualTo != "" {
+		var err error
+		if refFile, err = newReferenceFile(options.EqualTo); err != nil {
+			return results, err
+		}
+		data.onlySize = true
+		data.wantedSize = refFile.Size()
+	}
+
+	walk := filepath.Walk
+	if options.GitChanged {
+		walk = walkGitChanged
+	}
+
+	if options.TwoPass {
+		myLog.Println(1, "* Counting files")
+		data.progress.preScan(dirs, walk)
+		myLog.Println(2, "  Expecting", data.progress.expectedCount,
+			"files,", formatSize(data.progress.expectedSize, true))
+	}
+
+	checkNestedRoots(dirs)
 
 	myLog.Println(1, "* Reading file metadata")
 
-	for _, root := range dirs {
-		if err := filepath.Walk(root, visit); err != nil {
+	data.progress.start()
+	for i, root := range dirs {
+		data.currentRoot = i
+		if err := walk(root, visit); err != nil {
 			return results, fmt.Errorf("could not read file tree: %v", err)
 		}
 	}
 
+	results.BrokenSymlinks = data.brokenSymlinks
+
+	if data.cmpt < options.ExpectMinFiles {
+		return results, fmt.Errorf("%w: %d files scanned, expected at least %d",
+			errTooFewFiles, data.cmpt, options.ExpectMinFiles)
+	}
+
+	if data.casePaths != nil {
+		myLog.Println(1, "* Looking for case collisions")
+		results.CaseCollisions = data.caseCollisions()
+		results.TotalFileCount = data.cmpt
+		return results, nil
+	}
+
+	if options.BlockDedup > 0 {
+		myLog.Println(1, "* Computing block checksums")
+		results.BlockDedup = data.blockDedup(int(options.BlockDedup))
+		results.TotalFileCount = data.cmpt
+		return results, nil
+	}
+
+	if refFile != nil {
+		myLog.Println(1, "* Looking for copies of", refFile.FilePath)
+		equalList, err := data.findEqualTo(refFile)
+		if err != nil {
+			return results, err
+		}
+		results.EqualTo = equalList
+		results.TotalFileCount = data.cmpt
+		return results, nil
+	}
+
 	// Count empty files and drop them if they should be ignored
-	emptyCount := data.dropEmptyFiles(options.IgnoreEmpty)
+	ignoreEmpty := options.IgnoreEmpty
+	if _, ok := data.ignoreContent[hex.EncodeToString(sha1.New().Sum(nil))]; ok {
+		ignoreEmpty = true
+	}
+	emptyCount := data.dropEmptyFiles(ignoreEmpty)
 
 	// Display a small report
-	if verbose {
+	if verbose || selectedStats != nil {
 		if data.ignoreCount > 0 {
-			myLog.Printf(1, "  %d special files were ignored\n",
+			statsLog("walk", 1, "  %d special files were ignored\n",
 				data.ignoreCount)
 		}
-		myLog.Println(2, "  Initial counter:", data.cmpt, "files")
-		myLog.Println(2, "  Total size:", formatSize(data.totalSize,
+		if data.ignoreFileCount > 0 {
+			statsLog("walk", 1, "  %d files were ignored because of the ignore file\n",
+				data.ignoreFileCount)
+		}
+		if data.seenCount > 0 {
+			statsLog("walk", 1, "  %d files were ignored because they were already scanned\n",
+				data.seenCount)
+		}
+		if data.deviceIgnoreCount > 0 {
+			statsLog("walk", 1, "  %d files were ignored because of their device\n",
+				data.deviceIgnoreCount)
+		}
+		if data.nlinkIgnoreCount > 0 {
+			statsLog("walk", 1, "  %d files were ignored because of their link count\n",
+				data.nlinkIgnoreCount)
+		}
+		if data.sampler != nil {
+			statsLog("walk", 1, "  %d files were left out of the sample\n",
+				data.sampler.skipped)
+		}
+		statsLog("walk", 2, "  Initial counter: %d files\n", data.cmpt)
+		statsLog("walk", 2, "  Total size: %s\n", formatSize(data.totalSize,
 			false))
 		if emptyCount > 0 {
-			myLog.Printf(1, "  %d empty files were ignored\n",
+			statsLog("walk", 1, "  %d empty files were ignored\n",
 				emptyCount)
 		}
 		data.dispCount()
-		myLog.Println(3, "* Number of size groups:", len(data.sizeGroups))
+		statsLog("walk", 3, "* Number of size groups: %d\n", len(data.sizeGroups))
 	}
 
 	// Remove unique sizes and hard links
 	myLog.Println(1, "* Removing files with unique size and hard links...")
 	hardLinkCount, uniqueSizeCount := data.initialCleanup()
-	if verbose {
-		myLog.Printf(2, "  Dropped %d files with unique size\n",
+	results.InodeCollisions = data.inodeCollisions
+	if verbose || selectedStats != nil {
+		statsLog("cleanup", 2, "  Dropped %d files with unique size\n",
 			uniqueSizeCount)
-		myLog.Printf(2, "  Dropped %d hard links\n", hardLinkCount)
-		myLog.Println(3, "* Number of size groups:", len(data.sizeGroups))
+		statsLog("cleanup", 2, "  Dropped %d hard links\n", hardLinkCount)
+		statsLog("cleanup", 3, "* Number of size groups: %d\n", len(data.sizeGroups))
 		data.dispCount()
 	}
 
@@ -505,37 +1463,147 @@ func duf(dirs []string, options Options) (Results, error) {
 	myLog.Println(1, "* Computing checksums...")
 	var result foListList
 	if len(data.emptyFiles) > 0 {
-		result = append(result, data.emptyFiles)
+		if data.matchRelPath {
+			result = append(result, data.splitByRelPath(data.emptyFiles)...)
+		} else {
+			result = append(result, data.emptyFiles)
+		}
+		var kept foListList
+		for _, l := range result {
+			if data.emitGroup(l) {
+				kept = append(kept, l)
+			}
+		}
+		result = kept
+	}
+	// Partial checksums do not make sense with an external hash command,
+	// and they would include the regions skipped with --skip-header or
+	// --skip-footer.
+	skipPartial := options.SkipPartial || len(hashCommand) > 0 ||
+		skipHeader > 0 || skipFooter > 0
+	result = append(result, data.findDupes(skipPartial)...)
+	if data.unhashedCount > 0 {
+		statsLog("hashing", 1, "  %d files were not hashed because of --max-group-hash\n",
+			data.unhashedCount)
+	}
+	if data.ignoreContentCount > 0 {
+		statsLog("hashing", 1, "  %d files were ignored because of their content\n",
+			data.ignoreContentCount)
 	}
-	result = append(result, data.findDupes(options.SkipPartial)...)
 
-	myLog.Println(3, "* Number of match groups:", len(result))
+	statsLog("hashing", 3, "* Number of match groups: %d\n", len(result))
+
+	if options.DiffReference != "" {
+		myLog.Println(1, "* Looking for files missing from the reference")
+		results.Missing = data.findMissing(result, len(dirs)-1)
+		results.TotalFileCount = data.cmpt
+		return results, nil
+	}
+
+	if manifest != nil {
+		myLog.Println(1, "* Looking for files listed in the manifest...")
+		var allFiles FileObjList
+		for _, l := range result {
+			allFiles = append(allFiles, l...)
+		}
+		allFiles = append(allFiles, data.uniqueFiles...)
+		results.ManifestMatches = manifest.match(allFiles)
+	}
+
+	if ioBudgetExceeded() {
+		myLog.Println(-1, "Warning: I/O budget exceeded, the results are incomplete")
+		results.IOBudgetExceeded = true
+	}
+
+	if options.ExportStore != "" {
+		myLog.Println(1, "* Exporting files to the store...")
+		n, err := exportStore(options.ExportStore, result, data.uniqueFiles)
+		if err != nil {
+			return results, fmt.Errorf("could not export files: %v", err)
+		}
+		myLog.Println(2, "  Exported", n, "files")
+	}
+
+	if options.DirDupes {
+		myLog.Println(1, "* Looking for duplicate directories...")
+		results.DirGroups = findDuplicateDirs(dirs, result,
+			data.uniqueFiles, data.hardLinks)
+	}
+
+	if known != nil {
+		result = result.filterKnown(known)
+		myLog.Println(3, "* Number of groups not already known:", len(result))
+	}
+
+	if options.ReportNew {
+		result = result.filterNewDuplicates(newRoot)
+		myLog.Println(3, "* Number of groups with new files:", len(result))
+	}
 
 	// Done!  Prepare results data
 	if len(result) > 0 && !options.Summary {
-		if options.OutToJSON {
+		if options.OutToJSON || options.OutToNDJSON {
 			myLog.Println(1, "* Dumping dupes as JSON...")
+		} else if options.Unique {
+			myLog.Println(1, "* Unique files:")
+		} else if options.Manifest != "" {
+			myLog.Println(1, "* Manifest matches:")
+		} else if options.DirDupes {
+			myLog.Println(1, "* Duplicate directories:")
 		} else {
 			myLog.Println(1, "* Dupes:")
 		}
 	}
 
-	// Sort files by path inside each group
+	// Sort files inside each group (by path by default)
+	// With keep-first, the file to keep is listed first
+	var keepFirst func(FileObjList) *fileObj
+	if options.GroupMemberSort == memberSortKeepFirst {
+		keepFirst = func(l FileObjList) *fileObj {
+			return data.keepCandidate(l, options)
+		}
+	}
 	for _, l := range result {
-		sort.Sort(byFilePathName(l))
+		sortGroupMembers(l, options.GroupMemberSort, keepFirst)
 	}
+
+	// Only keep the groups wasting the most space.
+	// This only limits the output: all the groups have been found and
+	// confirmed at this point.
+	if options.MaxResults > 0 && uint(len(result)) > options.MaxResults {
+		sort.Sort(byGroupWaste(result))
+		results.OmittedGroups = uint(len(result)) - options.MaxResults
+		for i := options.MaxResults; i < uint(len(result)); i++ {
+			result[i] = nil
+		}
+		result = result[:options.MaxResults]
+	}
+
 	// Sort groups by increasing size (of the duplicated files)
-	sort.Sort(byGroupFileSize(result))
+	var groupOrder sort.Interface = byGroupFileSize(result)
+	if options.Reverse {
+		groupOrder = sort.Reverse(groupOrder)
+	}
+	sort.Sort(groupOrder)
 
 	// Build the result duplicate sets
 	for _, l := range result {
 		size := uint64(l[0].Size())
 		// We do not count the size of the 1st item
 		// so we get only duplicate size.
-		results.RedundantDataSizeBytes += size * uint64(len(l)-1)
-		newSet := ResultSet{FileSize: size}
+		results.RedundantDataSizeBytes += size * uint64(l.countInodes()-1)
+		newSet := ResultSet{FileSize: size, Hash: l.hashString()}
+		newSet.Unconfirmed = l[0].Hash == nil && l[0].PartialHash != nil
 		for _, f := range l {
 			newSet.Paths = append(newSet.Paths, f.FilePath)
+			newSet.ModTimes = append(newSet.ModTimes, f.ModTime())
+			if options.ShowCreated {
+				bt, _ := GetBirthTime(f.FilePath, f)
+				newSet.BirthTimes = append(newSet.BirthTimes, bt)
+			}
+			if len(dirs) > 1 {
+				newSet.Roots = append(newSet.Roots, f.root)
+			}
 			results.Duplicates++
 			if len(data.hardLinks[f.FilePath]) > 0 {
 				if newSet.Links == nil {
@@ -543,14 +1611,86 @@ func duf(dirs []string, options Options) (Results, error) {
 				}
 				newSet.Links[f.FilePath] = data.hardLinks[f.FilePath]
 			}
+			if options.ReportNew && f.root == newRoot {
+				newSet.New = append(newSet.New, f.FilePath)
+			}
+			if data.symlinks != nil {
+				var symlinks []string
+				for _, p := range append([]string{f.FilePath}, data.hardLinks[f.FilePath]...) {
+					symlinks = append(symlinks, data.symlinksTo(p)...)
+				}
+				if len(symlinks) > 0 {
+					if newSet.Symlinks == nil {
+						newSet.Symlinks = make(map[string][]string)
+					}
+					newSet.Symlinks[f.FilePath] = symlinks
+				}
+			}
+		}
+		if options.OldestNewest {
+			newSet.setOldestNewest()
+		}
+		newSet.Keep = data.chooseKeep(l, options)
+		if options.StableIDs {
+			newSet.StableID = l.stableID()
+		}
+		if options.Xattrs {
+			newSet.setXattrDiffers()
+		}
+		if options.NormalizeUnicode {
+			newSet.setUnicodeVariants()
+		}
+		newSet.PartiallySampled = data.sampledSizes[int64(size)]
+		if options.Scope {
+			newSet.Scope = data.groupScope(l)
+		}
+		if options.SeparateEmpty && size == 0 {
+			results.Duplicates -= uint(len(newSet.Paths))
+			results.EmptyGroups = append(results.EmptyGroups, newSet)
+			continue
 		}
 		results.Groups = append(results.Groups, newSet)
 	}
-	results.NumberOfSets = uint(len(results.Groups))
+	if options.Unique {
+		sort.Sort(byFilePathName(data.uniqueFiles))
+		for _, f := range data.uniqueFiles {
+			results.UniqueFiles = append(results.UniqueFiles, f.FilePath)
+		}
+	}
+	if len(dirs) > 1 {
+		results.Roots = dirs
+	}
+	if options.Histogram {
+		results.Histogram = buildHistogram(results.Groups)
+	}
+	results.TimedOut = timedOutList()
+	if data.suspected != nil {
+		results.Suspected = data.suspectedGroups()
+	}
+	results.Duplicates += data.released.duplicates
+	results.RedundantDataSizeBytes += data.released.redundant
+	results.NumberOfSets = uint(len(results.Groups)) + data.released.sets
 	results.RedundantDataSizeHuman = formatSize(results.RedundantDataSizeBytes, true)
 	results.TotalFileCount = data.cmpt
 	results.TotalSizeBytes = data.totalSize
 	results.TotalSizeHuman = formatSize(data.totalSize, true)
+	if data.totalSize > 0 {
+		results.DedupRatioPercent = 100 * float64(results.RedundantDataSizeBytes) /
+			float64(data.totalSize)
+	}
+	if data.sampler != nil {
+		results.Sampled = results.estimate(options.SampleRate)
+	}
+	if statsWanted("io") {
+		results.IO = getIOStats(data.candidateSize)
+	}
+	if verbose || selectedStats != nil {
+		results.LargestDuplicate = largestDuplicate(results.Groups)
+		if l := data.released.largest; l != nil && (results.LargestDuplicate == nil ||
+			l.SizeBytes > results.LargestDuplicate.SizeBytes) {
+			results.LargestDuplicate = l
+		}
+	}
 
 	return results, nil
 }
@@ -569,16 +1709,111 @@ func main() {
 	flag.BoolVar(&verbose, "verbose", false, "Be verbose (verbosity=1)")
 	flag.BoolVar(&verbose, "v", false, "See --verbose")
 	flag.BoolVar(&options.OutToJSON, "json", false, "Use JSON format for output")
+	flag.BoolVar(&options.CompactPaths, "json-compact-paths", false, "Use paths relative to the group directory in JSON output")
+	flag.BoolVar(&options.OutToNDJSON, "ndjson-files", false, "Output one JSON object per duplicate file")
+	flag.BoolVar(&options.Tree, "tree", false, "Display the duplicates as a directory tree")
+	flag.BoolVar(&options.Histogram, "histogram", false, "Display the distribution of the groups by number of copies")
 	flag.BoolVar(&options.Summary, "summary", false, "Do not display the duplicate list")
 	flag.BoolVar(&options.Summary, "s", false, "See --summary")
 	flag.BoolVar(&options.SkipPartial, "skip-partial", false, "Skip partial checksums")
+	flag.BoolVar(&options.CRCPrefilter, "crc-prefilter", false, "Compare the CRC32 of the first block before partial checksums")
+	flag.BoolVar(&options.PartialCDC, "partial-cdc", false, "Use content-defined samples for partial checksums")
+	flag.BoolVar(&options.FollowFirstOnly, "follow-first-only", false, "Keep the first file found in walk order (roots are walked in argument order)")
+	flag.BoolVar(&options.Sparse, "sparse", false, "Skip file holes when computing full checksums (hole layout must match)")
 	flag.BoolVar(&options.IgnoreEmpty, "no-empty", false, "Ignore empty files")
+	flag.BoolVar(&options.TwoPass, "two-pass", false, "Count files first to display the progress of the scan and of the checksum computation")
+	flag.BoolVar(&options.ReportNew, "report-new", false, "Only report duplicates of files from the last root found in the other roots")
+	flag.StringVar(&options.HashCmd, "hash-cmd", "", "External command used to hash files instead of SHA1 (\"{}\" is replaced with the file path)")
+	flag.BoolVar(&options.DirDupes, "dir-dupes", false, "Report directories with identical contents")
+	flag.BoolVar(&options.Unique, "unique", false, "Report files with a unique content instead of duplicates")
+	flag.Var(&options.IOBudget, "io-budget", "Stop computing checksums after reading this amount of data (e.g. 10G)")
+	flag.StringVar(&options.Exec, "exec", "", "Run a command for every duplicate group (\"{keep}\" is replaced with the first file, \"{dupes...}\" with the other ones)")
+	flag.Var(&options.UntilFree, "until-free", "Only remove duplicates in the --script output until this amount of data is reclaimed, largest groups first")
+	flag.BoolVar(&options.ScriptKeepDirs, "script-keep-dirs", false, "Do not remove the last file of a directory in the --script output")
+	flag.Var(&options.SkipHeader, "skip-header", "Exclude this number of bytes at the start of the files from the checksums (smaller files are hashed entirely)")
+	flag.Var(&options.SkipFooter, "skip-footer", "Exclude this number of bytes at the end of the files from the checksums")
+	flag.BoolVar(&options.ShowCreated, "show-created", false, "Display the creation time of the duplicate files, if available")
+	flag.BoolVar(&options.KeepOldestCreated, "keep-oldest-created", false, "Keep the file with the earliest creation time, if available")
+	flag.BoolVar(&options.Scope, "scope", false, "Tell whether the files of each group are in the same directory, in the same subtree or scattered")
+	flag.BoolVar(&options.CommonPrefix, "common-prefix", false, "Display the common directory of each group once, with relative paths")
+	flag.UintVar(&options.MaxGroupHash, "max-group-hash", 0, "Only hash this number (at least 2) of files of each size group (larger groups are partially sampled)")
+	flag.BoolVar(&options.RecordParameters, "record-parameters", false, "Include the scan parameters in the JSON output and HTML report")
+	flag.Var(&options.FastDevices, "fast-device", "Prefer keeping the files on the device of this path or with this \"major:minor\" number, may be repeated")
+	flag.Var(&options.OnlyDevices, "only-device", "Only scan files on the device of this path or with this \"major:minor\" number, may be repeated")
+	flag.StringVar(&options.GroupMemberSort, "group-member-sort", memberSortPath, "Order of the files inside groups (path, mtime, newest, keep-first)")
+	flag.BoolVar(&options.ReportUnreadable, "report-unreadable", false, "List the unreadable files as suspected duplicates when other files have the same size")
+	flag.StringVar(&options.HTML, "html", "", "Write an HTML report of the duplicate groups to this file")
+	flag.StringVar(&options.SQLScript, "sql-script", "", "Write the duplicate groups to this file as an SQL script creating an SQLite database (e.g. \"sqlite3 dupes.db < dupes.sql\")")
+	flag.StringVar(&options.Script, "script", "", "Write a shell script removing the duplicates (keeping the first file of each group)")
+	flag.BoolVar(&options.ExecShell, "exec-shell", false, "Run the --exec command with a shell")
+	flag.Var(extHashAlgorithms, "hash-for", "Use a specific hash algorithm for an extension (e.g. \"mkv=fnv128a\"), may be repeated")
+	flag.UintVar(&options.MaxResults, "max-results", 0, "Only report the duplicate groups wasting the most space, up to this number (output limit only, all the files are still hashed)")
+	flag.UintVar(&options.ExpectMinFiles, "expect-min-files", 0, "Exit with status 3 if fewer files are scanned")
+	flag.Var(&options.AlertOver, "alert-over", "Exit with status 4 if the redundant data size exceeds this amount (e.g. 10G)")
+	flag.Float64Var(&options.SampleRate, "sample-rate", 1, "Only scan a random fraction of the files and estimate the results")
+	flag.Int64Var(&options.Seed, "seed", 1, "Random seed for --sample-rate")
+	flag.BoolVar(&options.DirectIO, "direct-io", false, "Bypass the page cache when reading files (Linux)")
+	flag.StringVar(&options.ExportStore, "export-store", "", "Copy one file of each distinct content to `dir`, named by checksum")
+	flag.DurationVar(&options.Watch, "watch", 0, "Scan again when the trees change, checking every `interval`")
+	flag.BoolVar(&options.FastMatch, "fast-match", false, "Report likely duplicates using partial checksums only")
+	flag.BoolVar(&options.CaseCollisions, "detect-case-collisions", false, "Report paths differing only by case instead of duplicates")
+	flag.StringVar(&options.GroupSeparator, "group-separator", "", "Line displayed before each duplicate group (default empty)")
+	flag.BoolVar(&options.BrokenSymlinks, "report-broken-symlinks", false, "List the symbolic links whose target does not exist")
+	flag.BoolVar(&options.NoteSymlinks, "note-symlinks", false, "Display the symbolic links pointing to duplicate files")
+	flag.BoolVar(&options.ShowAge, "show-age", false, "Display the age of the duplicate files")
+	flag.BoolVar(&options.Stream, "stream", false, "Display the duplicate groups as soon as they are found (unsorted)")
+	flag.BoolVar(&options.OneLine, "oneline", false, "Display each duplicate group on a single line")
+	flag.BoolVar(&options.Reverse, "reverse", false, "Reverse the order of duplicate groups")
+	flag.BoolVar(&options.MergeRoots, "merge-roots", false, "Drop roots resolving to the same location as another root, or inside another root")
+	flag.BoolVar(&options.MatchRelPath, "match-relpath", false, "Only compare files with the same path relative to their root")
+	flag.BoolVar(&options.DedupRealPath, "dedup-realpath", false, "Skip files whose canonical path has already been scanned")
+	flag.BoolVar(&options.VerifyHardLinks, "verify-hardlinks", false, "Compare a sample of the contents of files with the same inode")
+	flag.StringVar(&options.Manifest, "manifest", "", "Report files whose checksum is listed in this sha1sum file")
+	flag.BoolVar(&options.StreamCompare, "stream-compare", false, "Confirm duplicates with a byte-to-byte comparison")
+	flag.StringVar(&options.SortLocale, "sort-locale", "", "Sort paths according to the specified locale (e.g. \"fr\")")
+	flag.Var(&selectedStats, "stats", "Only display these statistics (walk, cleanup, hashing, io), e.g. \"walk,io\" or \"-io\"")
+	flag.BoolVar(&options.Xattrs, "xattrs", false, "Show the duplicates whose extended attributes differ from the first file of the group")
+	flag.BoolVar(&options.OldestNewest, "oldest-newest", false, "Show the oldest and newest file of each group")
+	flag.UintVar(&options.ReadRetries, "read-retries", 0, "Retry reading a file this number of times after a transient error")
+	flag.DurationVar(&options.ReadTimeout, "read-timeout", 0, "Give up reading a file after this duration (e.g. 30s)")
+	flag.StringVar(&options.EqualTo, "equal-to", "", "Only list the files identical to this file")
+	flag.Var(&options.BlockDedup, "block-dedup", "Report block-level deduplication statistics for this block size (e.g. 4K)")
+	flag.StringVar(&options.DiffReference, "diff-reference", "", "List the files whose content is missing from this `directory`")
+	flag.BoolVar(&options.DiffReports, "diff-reports", false, "Compare two JSON reports given as arguments and list the new, resolved and changed groups")
+	flag.BoolVar(&options.IncludeStreams, "include-streams", false, "Include resource forks (macOS) and alternate data streams (Windows) in checksums")
+	flag.BoolVar(&options.ListRedundant, "list-redundant", false, "Only list the files that could be removed (all but the file to keep of each group)")
+	flag.BoolVar(&options.SeparateEmpty, "separate-empty", false, "List empty files separately from the duplicate groups")
+	flag.BoolVar(&options.NormalizeUnicode, "normalize-unicode", false, "Flag duplicates whose names only differ by Unicode normalization (and fold it with --detect-case-collisions)")
+	flag.BoolVar(&options.StableIDs, "stable-ids", false, "Display a group identifier based on the file contents, stable across runs")
+	flag.BoolVar(&options.GitChanged, "git-changed", false, "Only scan the modified and untracked files of git working trees")
+	flag.StringVar(&options.IgnoreFile, "ignore-file", "", "Read exclusion rules from this file (gitignore syntax)")
+	flag.StringVar(&options.IgnoreContent, "ignore-content", "", "Ignore files whose checksum is listed in this file")
+	flag.StringVar(&options.Known, "known", "", "Do not report duplicates whose checksum is listed in this file")
+	flag.Var(&options.Throttle, "throttle", "Limit the read throughput to this amount of data per second (e.g. 50M)")
+	flag.Uint64Var(&options.MinNlink, "min-nlink", 0, "Ignore files with fewer hard links")
+	flag.Uint64Var(&options.MaxNlink, "max-nlink", 0, "Ignore files with more hard links")
 	flag.IntVar(&myLog.verbosity, "verbosity", 0, "Set verbosity level (1-6)")
 	flag.IntVar(&myLog.verbosity, "vl", 0, "See verbosity")
 	timings := flag.Bool("timings", false, "Show detailed log timings")
+	logOutput := flag.String("log-output", "stderr", "Log messages destination (stderr or stdout)")
+	logJSON := flag.Bool("log-json", false, "Write log messages as JSON objects")
+	config := flag.String("config", "", "Read options from this file (command-line flags take precedence)")
 
 	flag.Parse()
 
+	// Environment variables take precedence over the configuration file
+	if err := loadEnv(); err != nil {
+		myLog.Fatal("ERROR: invalid environment variable: " + err.Error())
+	}
+	if *config != "" {
+		if err := loadConfig(*config); err != nil {
+			myLog.Fatal("ERROR: could not read configuration: " + err.Error())
+		}
+	}
+
+	myLog.SetJSON(*logJSON)
+	dumpInFlightOnSignal()
+
 	// Set verbosity: --verbose=true == --verbosity=1
 	if myLog.verbosity > 0 {
 		verbose = true
@@ -586,23 +1821,195 @@ func main() {
 		myLog.verbosity = 1
 	}
 
-	if len(flag.Args()) == 0 {
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = envRoots()
+	}
+	if len(roots) == 0 {
 		// TODO: more helpful usage statement
 		myLog.Println(-1, "Usage:", os.Args[0],
 			"[options] base_directory|file...")
 		os.Exit(0)
 	}
 
+	if options.DiffReports {
+		if len(roots) != 2 {
+			myLog.Fatal("ERROR: --diff-reports requires two report files")
+		}
+		if err := compareReports(roots[0], roots[1], options.OutToJSON); err != nil {
+			myLog.Fatal("ERROR: could not compare the reports: " + err.Error())
+		}
+		return
+	}
+
+	if options.ReportNew && len(roots) < 2 {
+		myLog.Fatal("ERROR: --report-new requires at least two roots")
+	}
+	if options.MatchRelPath && len(roots) < 2 {
+		myLog.Fatal("ERROR: --match-relpath requires at least two roots")
+	}
+
+	if options.MaxGroupHash == 1 {
+		myLog.Fatal("ERROR: --max-group-hash must be at least 2")
+	}
+	if options.SampleRate <= 0 || options.SampleRate > 1 {
+		myLog.Fatal("ERROR: the sample rate must be in the (0, 1] range")
+	}
+
+	if (options.MinNlink > 0 || options.MaxNlink > 0) && !OSHasInodes() {
+		myLog.Fatal("ERROR: link count filters are not supported on this system")
+	}
+
+	if options.FastMatch && (options.Unique || options.DirDupes ||
+		options.Manifest != "" || options.ExportStore != "" ||
+		options.DiffReference != "") {
+		myLog.Fatal("ERROR: --fast-match cannot be used with options requiring full checksums")
+	}
+	if options.FastMatch && (options.Script != "" || options.Exec != "" ||
+		options.ListRedundant || options.UntilFree > 0) {
+		myLog.Fatal("ERROR: --fast-match cannot be used with options acting on the duplicates")
+	}
+	if options.Stream && (options.OutToJSON || options.OutToNDJSON) {
+		myLog.Fatal("ERROR: --stream cannot be used with JSON output")
+	}
+	if options.Stream && (options.Unique || options.Manifest != "" ||
+		options.DirDupes || options.DiffReference != "" ||
+		options.EqualTo != "" || options.CaseCollisions ||
+		options.BlockDedup > 0) {
+		myLog.Fatal("ERROR: --stream can only be used to list duplicate files")
+	}
+	if (len(options.OnlyDevices) > 0 || len(options.FastDevices) > 0) &&
+		!OSHasInodes() {
+		myLog.Fatal("ERROR: device filters are not supported on this system")
+	}
+	switch options.GroupMemberSort {
+	case memberSortPath, memberSortMtime, memberSortNewest, memberSortKeepFirst:
+	default:
+		myLog.Fatal("ERROR: invalid group member sort: " + options.GroupMemberSort)
+	}
+	if options.FollowFirstOnly && options.KeepOldestCreated {
+		myLog.Fatal("ERROR: --follow-first-only and --keep-oldest-created cannot be used together")
+	}
+	if (options.SkipHeader > 0 || options.SkipFooter > 0) &&
+		(options.Sparse || options.HashCmd != "" || options.DirectIO) {
+		myLog.Fatal("ERROR: --skip-header and --skip-footer cannot be used with --sparse, --hash-cmd or --direct-io")
+	}
+	if options.Sparse && options.DirectIO {
+		myLog.Fatal("ERROR: --sparse and --direct-io cannot be used together")
+	}
+	if options.HashCmd != "" && len(extHashAlgorithms) > 0 {
+		myLog.Fatal("ERROR: --hash-cmd and --hash-for cannot be used together")
+	}
+	// Checksum lists use SHA1 (an external hash command is expected
+	// to match the lists)
+	if v := checksumVariant(options); v != "" && v != "--hash-cmd" &&
+		(options.Manifest != "" || options.Known != "" ||
+			options.IgnoreContent != "") {
+		myLog.Fatal("ERROR: --manifest, --known and --ignore-content require SHA1 checksums of the whole contents, they cannot be used with " + v)
+	}
+	if v := checksumVariant(options); v != "" && options.ExportStore != "" {
+		myLog.Fatal("ERROR: --export-store requires SHA1 checksums of the whole contents, it cannot be used with " + v)
+	}
+	if options.HashCmd != "" {
+		var err error
+		if hashCommand, err = parseHashCommand(options.HashCmd); err != nil {
+			myLog.Fatal("ERROR: " + err.Error())
+		}
+	}
+
+	switch *logOutput {
+	case "stderr":
+	case "stdout":
+		myLog.SetOutput(os.Stdout)
+	default:
+		myLog.Fatal("ERROR: invalid log output: " + *logOutput)
+	}
+
 	// Change log format for benchmarking
 	if *timings {
 		myLog.SetBenchFlags()
 	}
 
-	results, err := duf(flag.Args(), options)
+	ioBudget = uint64(options.IOBudget)
+	readTimeout = options.ReadTimeout
+	readRetries = options.ReadRetries
+	partialCDC = options.PartialCDC
+	sparseFiles = options.Sparse
+	skipHeader, skipFooter = int64(options.SkipHeader), int64(options.SkipFooter)
+	includeStreams = options.IncludeStreams
+	directIO = options.DirectIO
+	if options.Throttle > 0 {
+		readLimiter = newRateLimiter(uint64(options.Throttle))
+	}
+
+	if options.SortLocale != "" {
+		tag, err := language.Parse(options.SortLocale)
+		if err != nil {
+			myLog.Fatal("ERROR: invalid locale: " + err.Error())
+		}
+		pathCollator = collate.New(tag)
+	}
+
+	if options.Watch > 0 {
+		watch(roots, options.Watch, func() { run(roots, options) })
+	}
+	run(roots, options)
+}
+
+// run looks for duplicates and outputs the results.
+func run(dirs []string, options Options) {
+	results, err := duf(dirs, options)
 	if err != nil {
+		if errors.Is(err, errTooFewFiles) {
+			myLog.Println(-1, "ERROR: "+err.Error())
+			os.Exit(exitTooFewFiles)
+		}
 		myLog.Fatal("ERROR: " + err.Error())
 	}
 
+	if options.RecordParameters {
+		results.Parameters = scanParameters(dirs)
+	}
+
 	// Output the results
-	displayResults(results, options.OutToJSON, options.Summary)
+	displayResults(results, options)
+	displayTimedOut(results)
+	displayBrokenSymlinks(results)
+	displayInodeCollisions(results)
+	displayIOStats(results)
+
+	if options.Script != "" {
+		if err := writeDeletionScript(results, options.Script,
+			options.ScriptKeepDirs, uint64(options.UntilFree)); err != nil {
+			myLog.Fatal("ERROR: could not write script: " + err.Error())
+		}
+	}
+
+	if options.SQLScript != "" {
+		if err := writeSQLScript(results, options.SQLScript); err != nil {
+			myLog.Fatal("ERROR: could not write SQL script: " + err.Error())
+		}
+	}
+
+	if options.HTML != "" {
+		if err := writeHTML(results, options.HTML); err != nil {
+			myLog.Fatal("ERROR: could not write HTML report: " + err.Error())
+		}
+	}
+
+	if options.Exec != "" {
+		if err := execGroups(results, options.Exec, options.ExecShell); err != nil {
+			myLog.Fatal("ERROR: " + err.Error())
+		}
+	}
+
+	if options.AlertOver > 0 && results.RedundantDataSizeBytes > uint64(options.AlertOver) {
+		myLog.Printf(-1, "ALERT: redundant data size %s exceeds %s\n",
+			formatSize(results.RedundantDataSizeBytes, true),
+			formatSize(uint64(options.AlertOver), true))
+		// Keep watching in --watch mode
+		if options.Watch == 0 {
+			os.Exit(exitAlert)
+		}
+	}
 }
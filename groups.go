@@ -0,0 +1,307 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"path/filepath"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// relPath returns the path of the file relative to its root.
+func (data *dataT) relPath(fo *fileObj) string {
+	rel, err := filepath.Rel(data.roots[fo.root], fo.FilePath)
+	if err != nil {
+		return fo.FilePath
+	}
+	return rel
+}
+
+// Group scopes (--scope)
+const (
+	scopeSameDir   = "same-dir"
+	scopeSameTree  = "same-tree"
+	scopeScattered = "scattered"
+)
+
+// groupScope classifies the group according to the location of its files:
+// all in the same directory, all below a common subdirectory of their root,
+// or scattered.
+func (data *dataT) groupScope(l FileObjList) string {
+	dir := filepath.Dir(l[0].FilePath)
+	sameDir, sameRoot := true, true
+	paths := make([]string, len(l))
+	for i, fo := range l {
+		paths[i] = fo.FilePath
+		if filepath.Dir(fo.FilePath) != dir {
+			sameDir = false
+		}
+		if fo.root != l[0].root {
+			sameRoot = false
+		}
+	}
+	if sameDir {
+		return scopeSameDir
+	}
+	if sameRoot {
+		common := commonDir(paths)
+		if common != "" && common != filepath.Clean(data.roots[l[0].root]) {
+			return scopeSameTree
+		}
+	}
+	return scopeScattered
+}
+
+// largestDuplicate returns the largest file of the groups, or nil if there
+// is no group.
+func largestDuplicate(groups []ResultSet) *LargestFile {
+	var largest *LargestFile
+	for _, g := range groups {
+		if largest == nil || g.FileSize > largest.SizeBytes {
+			largest = &LargestFile{Path: g.Paths[0], SizeBytes: g.FileSize}
+		}
+	}
+	return largest
+}
+
+// splitByRelPath splits the list into lists of files with the same path
+// relative to their respective roots.  Files with a unique relative path
+// are discarded.
+func (data *dataT) splitByRelPath(fileList FileObjList) foListList {
+	byRelPath := make(map[string]FileObjList)
+	var relPaths []string
+	for _, fo := range fileList {
+		rel := data.relPath(fo)
+		if _, ok := byRelPath[rel]; !ok {
+			relPaths = append(relPaths, rel)
+		}
+		byRelPath[rel] = append(byRelPath[rel], fo)
+	}
+	var lists foListList
+	for _, rel := range relPaths {
+		l := byRelPath[rel]
+		if len(l) < 2 {
+			data.addUniqueFiles(l)
+			continue
+		}
+		lists = append(lists, l)
+	}
+	return lists
+}
+
+// emitGroup passes a confirmed duplicate group to the --stream callback.
+// It returns false if the group should not be kept, because it has been
+// streamed and the full results are not needed.
+func (data *dataT) emitGroup(l FileObjList) bool {
+	if data.onGroup != nil {
+		data.onGroup(l)
+	}
+	return !data.releaseGroups
+}
+
+// releasedStats contains the figures of the groups dropped after being
+// streamed, for the final statistics.
+type releasedStats struct {
+	sets       uint
+	duplicates uint
+	redundant  uint64
+	largest    *LargestFile
+}
+
+// add records the figures of a dropped group.
+func (r *releasedStats) add(l FileObjList) {
+	r.sets++
+	r.duplicates += uint(len(l))
+	r.redundant += uint64(l[0].Size()) * uint64(l.countInodes()-1)
+	if size := uint64(l[0].Size()); r.largest == nil || size > r.largest.SizeBytes {
+		r.largest = &LargestFile{Path: l[0].FilePath, SizeBytes: size}
+	}
+}
+
+// filterNewDuplicates only keeps the duplicate groups containing at least
+// one file from the newRoot root and one file from another root.
+func (groups foListList) filterNewDuplicates(newRoot int) foListList {
+	var filtered foListList
+	for _, l := range groups {
+		var hasNew, hasOld bool
+		for _, fo := range l {
+			if fo.root == newRoot {
+				hasNew = true
+			} else {
+				hasOld = true
+			}
+		}
+		if hasNew && hasOld {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
+}
+
+// filterKnown removes the duplicate groups whose checksum is listed in
+// the known set.
+func (groups foListList) filterKnown(known manifestT) foListList {
+	var filtered foListList
+	for _, l := range groups {
+		if _, ok := known[l.hashString()]; ok {
+			continue
+		}
+		filtered = append(filtered, l)
+	}
+	return filtered
+}
+
+// setOldestNewest sets the Oldest and Newest fields of the set, according
+// to the modification times of the files.  They are left empty if all the
+// files have the same modification time.
+func (g *ResultSet) setOldestNewest() {
+	var oldest, newest int
+	for i, t := range g.ModTimes {
+		if t.Before(g.ModTimes[oldest]) {
+			oldest = i
+		}
+		if t.After(g.ModTimes[newest]) {
+			newest = i
+		}
+	}
+	if g.ModTimes[oldest].Equal(g.ModTimes[newest]) {
+		return
+	}
+	g.Oldest = g.Paths[oldest]
+	g.Newest = g.Paths[newest]
+}
+
+// setXattrDiffers lists the files of the group whose extended attributes
+// differ from the ones of the first file.
+func (g *ResultSet) setXattrDiffers() {
+	var ref string
+	for i, p := range g.Paths {
+		sig, err := xattrSignature(p)
+		if err != nil {
+			myLog.Println(0, "Cannot read extended attributes:", err)
+			continue
+		}
+		if i == 0 {
+			ref = sig
+			continue
+		}
+		if sig != ref {
+			g.XattrDiffers = append(g.XattrDiffers, p)
+		}
+	}
+}
+
+// setUnicodeVariants lists the files of the group whose path only differs
+// from the path of another file of the group by Unicode normalization.
+func (g *ResultSet) setUnicodeVariants() {
+	byForm := make(map[string][]string)
+	for _, p := range g.Paths {
+		key := norm.NFC.String(p)
+		byForm[key] = append(byForm[key], p)
+	}
+	for _, p := range g.Paths {
+		if len(byForm[norm.NFC.String(p)]) > 1 {
+			g.UnicodeVariants = append(g.UnicodeVariants, p)
+		}
+	}
+}
+
+// histogramMaxCopies is the number of copies of the last histogram bucket
+const histogramMaxCopies = 10
+
+// HistogramBucket is the number of duplicate groups with a given number
+// of copies
+type HistogramBucket struct {
+	MinCopies int  `json:"min_copies"`
+	MaxCopies int  `json:"max_copies,omitempty"` // 0 if unbounded
+	Groups    uint `json:"groups"`
+}
+
+// buildHistogram computes the distribution of the groups by number of
+// copies.  Empty buckets are skipped.
+func buildHistogram(groups []ResultSet) []HistogramBucket {
+	counts := make([]uint, histogramMaxCopies+1)
+	for _, g := range groups {
+		n := len(g.Paths)
+		if n > histogramMaxCopies {
+			n = histogramMaxCopies
+		}
+		counts[n]++
+	}
+	var histogram []HistogramBucket
+	for n, c := range counts {
+		if c == 0 {
+			continue
+		}
+		b := HistogramBucket{MinCopies: n, MaxCopies: n, Groups: c}
+		if n == histogramMaxCopies {
+			b.MaxCopies = 0
+		}
+		histogram = append(histogram, b)
+	}
+	return histogram
+}
+
+// compacted returns a copy of the set with paths relative to their common
+// directory, which is stored in the Base field.
+// The hard links and symbolic links (the Links and Symlinks values) are
+// left unchanged.
+func (g ResultSet) compacted() ResultSet {
+	base := commonDir(g.Paths)
+	if base == "" {
+		return g
+	}
+	rel := func(p string) string {
+		if p == "" {
+			return p
+		}
+		if r, err := filepath.Rel(base, p); err == nil {
+			return r
+		}
+		return p
+	}
+	relList := func(paths []string) []string {
+		var l []string
+		for _, p := range paths {
+			l = append(l, rel(p))
+		}
+		return l
+	}
+	g.Base = base
+	g.Paths = relList(g.Paths)
+	g.New = relList(g.New)
+	g.Oldest, g.Newest = rel(g.Oldest), rel(g.Newest)
+	g.Keep = rel(g.Keep)
+	g.XattrDiffers = relList(g.XattrDiffers)
+	g.UnicodeVariants = relList(g.UnicodeVariants)
+	relKeys := func(m map[string][]string) map[string][]string {
+		if m == nil {
+			return nil
+		}
+		r := make(map[string][]string)
+		for p, l := range m {
+			r[rel(p)] = l
+		}
+		return r
+	}
+	g.Links = relKeys(g.Links)
+	g.Symlinks = relKeys(g.Symlinks)
+	return g
+}
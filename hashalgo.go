@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"hash/crc64"
+	"hash/fnv"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type hashFactory func() hash.Hash
+
+// hashAlgorithms lists the algorithms available for --hash-for.
+var hashAlgorithms = map[string]hashFactory{
+	"md5":     md5.New,
+	"sha1":    sha1.New,
+	"sha256":  sha256.New,
+	"sha512":  sha512.New,
+	"fnv128a": fnv.New128a,
+	"crc64": func() hash.Hash {
+		return crc64.New(crc64.MakeTable(crc64.ECMA))
+	},
+}
+
+// hashForValue is a flag.Value mapping file extensions to hash algorithms.
+// It is set with repeated "ext=algo" arguments.
+type hashForValue map[string]string
+
+// extHashAlgorithms contains the --hash-for settings.
+var extHashAlgorithms = make(hashForValue)
+
+func (v hashForValue) String() string {
+	var list []string
+	for ext, algo := range v {
+		list = append(list, ext+"="+algo)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func (v hashForValue) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return errors.New("expected ext=algorithm")
+	}
+	ext := strings.ToLower(strings.TrimPrefix(s[:i], "."))
+	algo := strings.ToLower(s[i+1:])
+	if _, ok := hashAlgorithms[algo]; !ok {
+		return errors.New("unknown hash algorithm: " + algo)
+	}
+	v[ext] = algo
+	return nil
+}
+
+// hashAlgorithmFor returns the algorithm configured for the file
+// extension, or an empty string.
+func hashAlgorithmFor(path string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	return extHashAlgorithms[ext]
+}
+
+// selectHashAlgorithm sets the hash algorithm of the files of the list.
+// The algorithm configured for their extension is used if they all agree,
+// SHA1 otherwise, since files hashed with different algorithms could not
+// be compared.
+func (fileList FileObjList) selectHashAlgorithm() {
+	if len(extHashAlgorithms) == 0 || len(fileList) == 0 {
+		return
+	}
+	algo := hashAlgorithmFor(fileList[0].FilePath)
+	for _, fo := range fileList[1:] {
+		if hashAlgorithmFor(fo.FilePath) != algo {
+			algo = ""
+			break
+		}
+	}
+	for _, fo := range fileList {
+		fo.hashAlgo = hashAlgorithms[algo]
+	}
+}
+
+// newHash returns a new hash for the file checksums.
+func (fo *fileObj) newHash() hash.Hash {
+	if fo.hashAlgo != nil {
+		return fo.hashAlgo()
+	}
+	return sha1.New()
+}
+
+// checksumVariant returns the option which makes the full checksums differ
+// from the SHA1 of the file contents, or an empty string.
+func checksumVariant(options Options) string {
+	switch {
+	case options.HashCmd != "":
+		return "--hash-cmd"
+	case len(extHashAlgorithms) > 0:
+		return "--hash-for"
+	case options.Sparse:
+		return "--sparse"
+	case options.SkipHeader > 0:
+		return "--skip-header"
+	case options.SkipFooter > 0:
+		return "--skip-footer"
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// hashCommand is the external command used instead of SHA1 to compute
+// the file checksums, if set.  The "{}" argument is replaced with the
+// file path.
+var hashCommand []string
+
+// parseHashCommand splits the --hash-cmd template into arguments.
+// If there is no "{}" placeholder, the path is appended to the arguments.
+// No shell is involved, so the arguments cannot contain spaces.
+func parseHashCommand(template string) ([]string, error) {
+	args := strings.Fields(template)
+	if len(args) == 0 {
+		return nil, errors.New("empty hash command")
+	}
+	for _, a := range args {
+		if a == "{}" {
+			return args, nil
+		}
+	}
+	return append(args, "{}"), nil
+}
+
+// externalChecksum runs the hash command on the file and uses the first
+// word of its output as the file hash, so that the usual "hash  filename"
+// format of the *sum tools is supported.
+func (fo *fileObj) externalChecksum() error {
+	args := make([]string, len(hashCommand))
+	for i, a := range hashCommand {
+		if a == "{}" {
+			a = fo.FilePath
+		}
+		args[i] = a
+	}
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		return errors.New("hash command failed for " + fo.FilePath +
+			": " + err.Error())
+	}
+	fields := bytes.Fields(out)
+	if len(fields) == 0 {
+		return errors.New("hash command returned nothing for " +
+			fo.FilePath)
+	}
+	fo.Hash = fields[0]
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bufio"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>goduf report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.summary td { padding: 0.2em 1em 0.2em 0; }
+details { margin: 0.3em 0; }
+summary { cursor: pointer; }
+ul { font-family: monospace; }
+.link { color: gray; }
+</style>
+</head>
+<body>
+<h1>Duplicate files</h1>
+<table class="summary">
+<tr><td>Report date</td><td>{{.Date.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><td>Scanned files</td><td>{{.Results.TotalFileCount}} ({{size .Results.TotalSizeBytes}})</td></tr>
+<tr><td>Duplicate files</td><td>{{.Results.Duplicates}} in {{len .Results.Groups}} sets</td></tr>
+<tr><td>Redundant data size</td><td>{{size .Results.RedundantDataSizeBytes}} ({{printf "%.1f" .Results.DedupRatioPercent}}%)</td></tr>
+</table>
+{{- with .Results.Parameters}}
+<details>
+<summary>Scan parameters</summary>
+<table class="summary">
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Roots</td><td>{{range .Roots}}{{.}}<br>{{end}}</td></tr>
+<tr><td>Hash algorithm</td><td>{{.HashAlgorithm}}</td></tr>
+{{- range $ext, $algo := .HashFor}}
+<tr><td>Hash for .{{$ext}}</td><td>{{$algo}}</td></tr>
+{{- end}}
+{{- range $name, $value := .Flags}}
+<tr><td>--{{$name}}</td><td>{{$value}}</td></tr>
+{{- end}}
+</table>
+</details>
+{{- end}}
+{{range $i, $g := .Results.Groups}}
+<details>
+<summary>Group #{{inc $i}}: {{len $g.Paths}} files * {{size $g.FileSize}}</summary>
+<ul>
+{{- range $g.Paths}}
+<li><a href="{{fileURL .}}">{{.}}</a>
+{{- range index $g.Links .}}
+<br><span class="link">&nbsp;&nbsp;{{.}} (hard link)</span>
+{{- end}}</li>
+{{- end}}
+</ul>
+</details>
+{{- end}}
+</body>
+</html>
+`
+
+// fileURL returns a file: URL for the path.
+func fileURL(path string) template.URL {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return template.URL(u.String())
+}
+
+// writeHTML writes a self-contained HTML report of the duplicate groups.
+func writeHTML(results Results, filename string) error {
+	funcs := template.FuncMap{
+		"size":    func(n uint64) string { return formatSize(n, true) },
+		"inc":     func(i int) int { return i + 1 },
+		"fileURL": fileURL,
+	}
+	tmpl, err := template.New("report").Funcs(funcs).Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	err = tmpl.Execute(w, struct {
+		Results Results
+		Date    time.Time
+	}{results, time.Now()})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
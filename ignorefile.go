@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is a pattern from a gitignore-style file
+type ignoreRule struct {
+	segments []string // Pattern split on '/', "**" matches any number of segments
+	negate   bool     // Re-include matching paths ("!pattern")
+	dirOnly  bool     // Only match directories ("pattern/")
+}
+
+// ignoreRules is the list of rules of an ignore file, in file order
+type ignoreRules []ignoreRule
+
+// loadIgnoreFile reads include/exclude rules using the gitignore syntax.
+func loadIgnoreFile(filename string) (ignoreRules, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// A pattern without a slash matches at any level; otherwise
+		// it is relative to the root.
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			return nil, fmt.Errorf("%s:%d: invalid pattern", filename, n)
+		}
+		rule.segments = strings.Split(line, "/")
+		for _, s := range rule.segments {
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid pattern", filename, n)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// matchSegments checks the path segments against the pattern segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignored returns true if the path (relative to its root, with slashes)
+// is excluded by the rules.  The last matching rule wins.
+func (rules ignoreRules) ignored(rel string, isDir bool) bool {
+	name := strings.Split(rel, "/")
+	var ignored bool
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(r.segments, name) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// ignoredByRules checks a file found during the walk against the ignore
+// file rules, using its path relative to the current root.
+func (data *dataT) ignoredByRules(fpath string, isDir bool) bool {
+	rel, err := filepath.Rel(data.roots[data.currentRoot], fpath)
+	if err != nil || rel == "." {
+		return false
+	}
+	return data.ignoreRules.ignored(filepath.ToSlash(rel), isDir)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// inFlightT keeps track of the files being checksummed, so that a stalled
+// scan can be diagnosed (the list is displayed on SIGUSR1).
+type inFlightT struct {
+	sync.Mutex
+	files map[string]inFlightEntry
+}
+
+type inFlightEntry struct {
+	sType sumType
+	start time.Time
+}
+
+var inFlight = inFlightT{files: make(map[string]inFlightEntry)}
+
+// begin records the start of a checksum computation.
+func (t *inFlightT) begin(path string, sType sumType) {
+	if sType == partialChecksum {
+		myLog.Println(6, "Computing partial checksum:", path)
+	} else {
+		myLog.Println(6, "Computing checksum:", path)
+	}
+	t.Lock()
+	t.files[path] = inFlightEntry{sType, time.Now()}
+	t.Unlock()
+}
+
+// end records the end of a checksum computation.
+func (t *inFlightT) end(path string) {
+	t.Lock()
+	delete(t.files, path)
+	t.Unlock()
+}
+
+// dump displays the files being checksummed and for how long.
+func (t *inFlightT) dump() {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.files) == 0 {
+		myLog.Println(0, "No checksum in progress")
+		return
+	}
+	paths := make([]string, 0, len(t.files))
+	for p := range t.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		e := t.files[p]
+		kind := "full"
+		if e.sType == partialChecksum {
+			kind = "partial"
+		}
+		myLog.Printf(0, "Computing %s checksum for %v: %s\n", kind,
+			time.Since(e.start).Round(time.Second), p)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// bytesRead is the amount of data read so far to compute checksums.
+// It must be accessed atomically.
+var bytesRead uint64
+
+// partialBytesRead and fullBytesRead split bytesRead between partial
+// and full reads.  They must be accessed atomically.
+var partialBytesRead, fullBytesRead uint64
+
+// ioBudget is the maximum amount of data we can read (0 for no limit)
+var ioBudget uint64
+
+var errIOBudget = errors.New("I/O budget exceeded")
+
+// addBytesRead updates the read data counters.
+func addBytesRead(sType sumType, n int64) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddUint64(&bytesRead, uint64(n))
+	if sType == partialChecksum {
+		atomic.AddUint64(&partialBytesRead, uint64(n))
+	} else {
+		atomic.AddUint64(&fullBytesRead, uint64(n))
+	}
+}
+
+// resetIOStats resets the read data counters.
+func resetIOStats() {
+	atomic.StoreUint64(&bytesRead, 0)
+	atomic.StoreUint64(&partialBytesRead, 0)
+	atomic.StoreUint64(&fullBytesRead, 0)
+}
+
+// ioBudgetExceeded returns true if we have read more data than allowed.
+func ioBudgetExceeded() bool {
+	return ioBudget > 0 && atomic.LoadUint64(&bytesRead) >= ioBudget
+}
+
+// IOStats contains the amount of data read to compute checksums, compared
+// to the size of the files that had to be checked.
+type IOStats struct {
+	CandidateSizeBytes uint64 `json:"candidate_size_bytes"` // Size of the files with a non-unique size
+	PartialBytesRead   uint64 `json:"partial_bytes_read"`   // Data read for partial checksums
+	FullBytesRead      uint64 `json:"full_bytes_read"`      // Data read for full checksums or comparisons
+}
+
+// getIOStats returns the current read counters.
+func getIOStats(candidateSize uint64) *IOStats {
+	return &IOStats{
+		CandidateSizeBytes: candidateSize,
+		PartialBytesRead:   atomic.LoadUint64(&partialBytesRead),
+		FullBytesRead:      atomic.LoadUint64(&fullBytesRead),
+	}
+}
+
+// ratio returns the amount of data read relative to the candidate size.
+func (s IOStats) ratio() float64 {
+	if s.CandidateSizeBytes == 0 {
+		return 0
+	}
+	return float64(s.PartialBytesRead+s.FullBytesRead) /
+		float64(s.CandidateSizeBytes)
+}
@@ -20,43 +20,100 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 type myLogT struct {
 	verbosity int
+	out       io.Writer // Standard error if nil
+	json      bool      // Emit messages as JSON objects
+}
+
+type jsonLogEntry struct {
+	Level int       `json:"level"`
+	Time  time.Time `json:"time"`
+	Msg   string    `json:"msg"`
+}
+
+// printJSON writes the message as a JSON object.
+func (l *myLogT) printJSON(level int, msg string) {
+	entry := jsonLogEntry{
+		Level: level,
+		Time:  time.Now(),
+		Msg:   strings.TrimSuffix(msg, "\n"),
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(l.output(), string(b))
+}
+
+// output returns the log writer.
+func (l *myLogT) output() io.Writer {
+	if l.out == nil {
+		return os.Stderr
+	}
+	return l.out
 }
 
 func (l *myLogT) Printf(level int, format string, args ...interface{}) {
 	if level > l.verbosity {
 		return
 	}
+	if l.json {
+		l.printJSON(level, fmt.Sprintf(format, args...))
+		return
+	}
 	if level >= 0 {
 		log.Printf(format, args...)
 		return
 	}
 	// Error message without timestamp
-	fmt.Fprintf(os.Stderr, format, args...)
+	fmt.Fprintf(l.output(), format, args...)
 }
 
 func (l *myLogT) Println(level int, args ...interface{}) {
 	if level > l.verbosity {
 		return
 	}
+	if l.json {
+		l.printJSON(level, fmt.Sprintln(args...))
+		return
+	}
 	if level >= 0 {
 		log.Println(args...)
 		return
 	}
 	// Error message without timestamp
-	fmt.Fprintln(os.Stderr, args...)
+	fmt.Fprintln(l.output(), args...)
 }
 
 func (l *myLogT) Fatal(args ...interface{}) {
+	if l.json {
+		l.printJSON(-1, fmt.Sprint(args...))
+		os.Exit(1)
+	}
 	log.Fatal(args...)
 }
 
+// SetOutput sets the log destination.
+func (l *myLogT) SetOutput(w io.Writer) {
+	l.out = w
+	log.SetOutput(w)
+}
+
+// SetJSON enables or disables JSON-formatted messages.
+func (l *myLogT) SetJSON(enabled bool) {
+	l.json = enabled
+}
+
 func (l *myLogT) SetBenchFlags() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 }
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// manifestT maps checksums to the file names listed in a manifest
+type manifestT map[string][]string
+
+// ManifestMatch contains the scanned files matching a manifest checksum
+type ManifestMatch struct {
+	Hash    string   `json:"hash"`             // File checksum
+	Entries []string `json:"manifest_entries"` // Names from the manifest
+	Paths   []string `json:"paths"`            // Scanned files
+}
+
+// loadManifest reads a checksum list in the sha1sum format, i.e. lines
+// with a checksum and a file name ("HASH  NAME" or "HASH *NAME").
+// The file name is optional.  Empty lines and comments are ignored.
+func loadManifest(filename string) (manifestT, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := make(manifestT)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		hash := strings.ToLower(fields[0])
+		if len(hash) < 8 {
+			return nil, fmt.Errorf("%s:%d: invalid checksum",
+				filename, n)
+		}
+		var name string
+		if len(fields) > 1 {
+			name = strings.TrimLeft(fields[1], " *")
+		}
+		manifest[hash] = append(manifest[hash], name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// match computes the full checksum of the files and returns the
+// ones listed in the manifest.
+func (manifest manifestT) match(fileList FileObjList) []ManifestMatch {
+	var matchList FileObjList
+	for _, fo := range fileList {
+		if err := fo.stat(); err != nil {
+			myLog.Println(0, "Error:", err)
+			continue
+		}
+		matchList = append(matchList, fo)
+	}
+
+	// Sort the list for better efficiency
+	sort.Sort(ByInode(matchList))
+
+	matches := make(map[string]*ManifestMatch)
+	for _, fo := range matchList {
+		if fo.Hash == nil {
+			if err := fo.Sum(fullChecksum); err != nil {
+				if err != errIOBudget {
+					myLog.Println(0, "Error:", err)
+				}
+				continue
+			}
+		}
+		hash := FileObjList{fo}.hashString()
+		entries, ok := manifest[hash]
+		if !ok {
+			continue
+		}
+		m, ok := matches[hash]
+		if !ok {
+			m = &ManifestMatch{Hash: hash, Entries: entries}
+			matches[hash] = m
+		}
+		m.Paths = append(m.Paths, fo.FilePath)
+	}
+
+	var matchResults []ManifestMatch
+	for _, m := range matches {
+		sort.Slice(m.Paths, func(i, j int) bool {
+			return pathLess(m.Paths[i], m.Paths[j])
+		})
+		matchResults = append(matchResults, *m)
+	}
+	sort.Slice(matchResults, func(i, j int) bool {
+		return pathLess(matchResults[i].Paths[0], matchResults[j].Paths[0])
+	})
+	return matchResults
+}
@@ -22,6 +22,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
 // formatSize returns the size in a string with a human-readable format.
@@ -52,26 +56,87 @@ func formatSize(sizeBytes uint64, short bool) string {
 	return fmt.Sprintf("%d bytes (%d %s)", sizeBytes, humanSize, units[n])
 }
 
+// formatAge returns a short human-readable form of the duration
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", d/time.Minute)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", d/time.Hour)
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", d/(24*time.Hour))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", d/(30*24*time.Hour))
+	}
+	return fmt.Sprintf("%dy ago", d/(365*24*time.Hour))
+}
+
 // displayResults formats results to plaintext or JSON and sends them to stdout
-func displayResults(results Results, jsonOutput bool, summaryOnly bool) {
-	if jsonOutput {
+func displayResults(results Results, options Options) {
+	if options.OutToJSON {
+		if options.CompactPaths {
+			groups := make([]ResultSet, len(results.Groups))
+			for i, g := range results.Groups {
+				groups[i] = g.compacted()
+			}
+			results.Groups = groups
+		}
 		displayResultsJSON(results)
 		return
 	}
+	if options.OutToNDJSON {
+		displayResultsNDJSONFiles(results)
+		return
+	}
 
-	if !summaryOnly {
-		for i, g := range results.Groups {
-			fmt.Printf("\nGroup #%d (%d files * %v):\n", i+1,
-				len(g.Paths), formatSize(g.FileSize, true))
-			for _, f := range g.Paths {
-				fmt.Println(f)
-				if g.Links != nil { // Display linked files
-					for _, lf := range g.Links[f] {
-						fmt.Printf(" %s\n", lf)
-					}
-				}
-			}
+	summaryOnly := options.Summary
+	if options.BlockDedup > 0 {
+		displayBlockDedup(results, summaryOnly)
+		return
+	}
+	if options.DiffReference != "" {
+		displayMissing(results, summaryOnly)
+		return
+	}
+	if options.CaseCollisions {
+		displayCaseCollisions(results, summaryOnly)
+		return
+	}
+	if options.EqualTo != "" {
+		displayEqualTo(results, summaryOnly)
+		return
+	}
+	if options.Unique {
+		displayUniqueFiles(results, summaryOnly)
+		return
+	}
+	if options.Manifest != "" {
+		displayManifestMatches(results, summaryOnly)
+		return
+	}
+	if options.DirDupes {
+		displayDirGroups(results, summaryOnly)
+		return
+	}
+
+	if !summaryOnly && !options.Stream {
+		if options.Tree {
+			displayTree(results)
+		} else if options.OneLine {
+			displayGroupsOneLine(results)
+		} else if options.ListRedundant {
+			displayRedundant(results)
+		} else {
+			displayGroups(results, options)
 		}
+		displayEmptyGroups(results)
+		displaySuspected(results)
+	}
+
+	if options.Histogram {
+		displayHistogram(results.Histogram)
 	}
 
 	// We're done if we do not display statistics
@@ -84,9 +149,426 @@ func displayResults(results Results, jsonOutput bool, summaryOnly bool) {
 		fmt.Println()
 	}
 	myLog.Println(0, "Final count:", results.Duplicates,
-		"duplicate files in", len(results.Groups), "sets")
+		"duplicate files in", results.NumberOfSets, "sets")
 	myLog.Println(0, "Redundant data size:",
 		formatSize(results.RedundantDataSizeBytes, false))
+	if n := countPaths(results.EmptyGroups); n > 0 {
+		myLog.Println(0, n, "empty files are listed separately")
+	}
+	if results.TotalSizeBytes > 0 {
+		myLog.Printf(0, "Duplicated data: %.1f%% of the scanned data\n",
+			results.DedupRatioPercent)
+	}
+	if l := results.LargestDuplicate; l != nil {
+		statsLog("hashing", 1, "Largest duplicate file: %s (%s)\n", l.Path,
+			formatSize(l.SizeBytes, true))
+	}
+	if results.IOBudgetExceeded {
+		myLog.Println(0, "The I/O budget was exceeded: the results are incomplete")
+	}
+	if results.OmittedGroups > 0 {
+		myLog.Println(0, "The results are truncated:", results.OmittedGroups,
+			"more sets were left out")
+	}
+	var unconfirmed int
+	for _, g := range results.Groups {
+		if g.Unconfirmed {
+			unconfirmed++
+		}
+	}
+	if unconfirmed > 0 {
+		myLog.Println(0, unconfirmed, "sets are likely duplicates",
+			"(only partial checksums have been compared)")
+	}
+	if e := results.Sampled; e != nil {
+		myLog.Printf(0, "Sampled %g%% of the files, estimated totals: "+
+			"%d duplicate files, %s redundant data\n", e.Rate*100,
+			e.Duplicates, formatSize(e.RedundantDataSizeBytes, true))
+	}
+}
+
+// countPaths returns the number of files of the groups
+func countPaths(groups []ResultSet) int {
+	var n int
+	for _, g := range groups {
+		n += len(g.Paths)
+	}
+	return n
+}
+
+// displayRedundant lists the files that could be removed, i.e. all the
+// files of the groups except the ones to keep.
+// Unconfirmed groups (--fast-match) are skipped.
+func displayRedundant(results Results) {
+	for _, g := range results.Groups {
+		if g.Unconfirmed {
+			continue
+		}
+		_, dupes := g.survivor()
+		for _, f := range dupes {
+			fmt.Println(f)
+		}
+	}
+}
+
+// displayEmptyGroups lists the empty files (--separate-empty)
+func displayEmptyGroups(results Results) {
+	if len(results.EmptyGroups) == 0 {
+		return
+	}
+	fmt.Printf("\nEmpty files (%d):\n", countPaths(results.EmptyGroups))
+	for _, g := range results.EmptyGroups {
+		for _, f := range g.Paths {
+			fmt.Println(f)
+		}
+	}
+}
+
+// displaySuspected lists the unreadable files which have the same size
+// as other files (--report-unreadable)
+func displaySuspected(results Results) {
+	if len(results.Suspected) == 0 {
+		return
+	}
+	fmt.Printf("\nSuspected duplicates (unreadable files):\n")
+	for _, g := range results.Suspected {
+		for _, f := range g.Paths {
+			fmt.Printf("%s (%s)\n", f, formatSize(g.FileSize, true))
+		}
+	}
+}
+
+// displayTimedOut lists the files that could not be read in time, on
+// the standard error output
+func displayTimedOut(results Results) {
+	if len(results.TimedOut) == 0 {
+		return
+	}
+	myLog.Println(-1, "Files skipped because of a read timeout:")
+	for _, f := range results.TimedOut {
+		myLog.Println(-1, " ", f)
+	}
+}
+
+// displayIOStats displays the amount of data read to compute checksums
+func displayIOStats(results Results) {
+	if s := results.IO; s != nil && s.CandidateSizeBytes > 0 {
+		statsLog("io", 1, "Data read: %s partial + %s full for %s of candidate files (%.1f%%)\n",
+			formatSize(s.PartialBytesRead, true),
+			formatSize(s.FullBytesRead, true),
+			formatSize(s.CandidateSizeBytes, true), 100*s.ratio())
+	}
+}
+
+// displayBrokenSymlinks lists the dangling symbolic links found during
+// the scan, on the standard error output
+func displayBrokenSymlinks(results Results) {
+	if len(results.BrokenSymlinks) == 0 {
+		return
+	}
+	myLog.Println(-1, "Broken symbolic links:")
+	for _, f := range results.BrokenSymlinks {
+		myLog.Println(-1, " ", f)
+	}
+}
+
+// displayInodeCollisions lists the files sharing an inode number but with
+// different contents (--verify-hardlinks)
+func displayInodeCollisions(results Results) {
+	if len(results.InodeCollisions) == 0 {
+		return
+	}
+	myLog.Println(-1, "Files with the same inode but different contents:")
+	for _, c := range results.InodeCollisions {
+		myLog.Println(-1, " ", strings.Join(c, " <> "))
+	}
+}
+
+// displayGroups displays the list of duplicate groups, each one preceded
+// by the separator line
+func displayGroups(results Results, options Options) {
+	now := time.Now()
+	for i, g := range results.Groups {
+		if options.CommonPrefix {
+			g = g.compacted()
+		}
+		var status string
+		if g.Unconfirmed {
+			status = ", unconfirmed"
+		}
+		if g.PartiallySampled {
+			status += ", partially sampled"
+		}
+		if g.Scope != "" {
+			status += ", " + g.Scope
+		}
+		fmt.Println(options.GroupSeparator)
+		var id string
+		if g.StableID != "" {
+			id = " [" + g.StableID + "]"
+		}
+		fmt.Printf("Group #%d%s (%d files * %v%s):\n", i+1, id,
+			len(g.Paths), formatSize(g.FileSize, true), status)
+		if g.Base != "" {
+			fmt.Printf("In %s:\n", g.Base)
+		}
+		isNew := make(map[string]bool)
+		for _, f := range g.New {
+			isNew[f] = true
+		}
+		xattrDiffers := make(map[string]bool)
+		for _, f := range g.XattrDiffers {
+			xattrDiffers[f] = true
+		}
+		unicodeVariants := make(map[string]bool)
+		for _, f := range g.UnicodeVariants {
+			unicodeVariants[f] = true
+		}
+		for j, f := range g.Paths {
+			var tags []string
+			if options.ShowAge && j < len(g.ModTimes) {
+				tags = append(tags, "("+formatAge(now.Sub(g.ModTimes[j]))+")")
+			}
+			if j < len(g.BirthTimes) && !g.BirthTimes[j].IsZero() {
+				tags = append(tags, "(created "+
+					g.BirthTimes[j].Format("2006-01-02 15:04:05")+")")
+			}
+			if isNew[f] {
+				tags = append(tags, "(new)")
+			}
+			if xattrDiffers[f] {
+				tags = append(tags, "(xattr differs)")
+			}
+			if unicodeVariants[f] {
+				tags = append(tags, "(unicode variant)")
+			}
+			if f == g.Keep {
+				tags = append(tags, "(keep)")
+			}
+			if f == g.Oldest {
+				tags = append(tags, "(oldest)")
+			} else if f == g.Newest {
+				tags = append(tags, "(newest)")
+			}
+			if len(tags) > 0 {
+				fmt.Println(f, strings.Join(tags, " "))
+			} else {
+				fmt.Println(f)
+			}
+			if g.Links != nil { // Display linked files
+				for _, lf := range g.Links[f] {
+					fmt.Printf(" %s\n", lf)
+				}
+			}
+			for _, sl := range g.Symlinks[f] {
+				fmt.Printf(" %s (symlink)\n", sl)
+			}
+		}
+	}
+}
+
+// displayStreamGroup displays a duplicate group as soon as it is found
+// (--stream)
+func displayStreamGroup(l FileObjList) {
+	paths := make([]string, len(l))
+	for i, fo := range l {
+		paths[i] = fo.FilePath
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return pathLess(paths[i], paths[j])
+	})
+	fmt.Printf("\nGroup (%d files * %v):\n", len(paths),
+		formatSize(uint64(l[0].Size()), true))
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+}
+
+// onelineMaxWidth is the width limit of the --oneline output lines.
+// Paths are left out when a line would be longer.
+const onelineMaxWidth = 160
+
+// displayGroupsOneLine displays each duplicate group on a single line
+func displayGroupsOneLine(results Results) {
+	for _, g := range results.Groups {
+		line := fmt.Sprintf("%v x%d: ", formatSize(g.FileSize, true),
+			len(g.Paths))
+		if g.StableID != "" {
+			line = "[" + g.StableID + "] " + line
+		}
+		for i, f := range g.Paths {
+			if i > 0 {
+				// Keep room for the suffix unless this is the last path
+				var reserved int
+				if i < len(g.Paths)-1 {
+					reserved = len(fmt.Sprintf(" (+%d more)", len(g.Paths)-i-1))
+				}
+				if len(line)+len(" | ")+len(f)+reserved > onelineMaxWidth {
+					line += fmt.Sprintf(" (+%d more)", len(g.Paths)-i)
+					break
+				}
+				line += " | "
+			}
+			line += f
+		}
+		fmt.Println(line)
+	}
+}
+
+// displayHistogram displays the distribution of the groups by number of
+// copies
+func displayHistogram(histogram []HistogramBucket) {
+	fmt.Printf("\n%-8s %s\n", "Copies", "Groups")
+	for _, b := range histogram {
+		copies := fmt.Sprint(b.MinCopies)
+		if b.MaxCopies == 0 {
+			copies += "+"
+		}
+		fmt.Printf("%-8s %d\n", copies, b.Groups)
+	}
+}
+
+// displayUniqueFiles displays the list of files with a unique content
+func displayUniqueFiles(results Results, summaryOnly bool) {
+	if !summaryOnly {
+		for _, f := range results.UniqueFiles {
+			fmt.Println(f)
+		}
+	}
+
+	if myLog.verbosity < 1 && !summaryOnly {
+		return
+	}
+
+	if len(results.UniqueFiles) > 0 && myLog.verbosity > 0 {
+		fmt.Println()
+	}
+	myLog.Println(0, "Final count:", len(results.UniqueFiles),
+		"unique files")
+}
+
+// displayBlockDedup displays the block-level deduplication statistics
+func displayBlockDedup(results Results, summaryOnly bool) {
+	stats := results.BlockDedup
+	if stats == nil {
+		return
+	}
+	if !summaryOnly {
+		for _, f := range stats.SharingFiles {
+			fmt.Printf("%s: %d/%d blocks shared\n", f.Path,
+				f.SharedBlocks, f.TotalBlocks)
+		}
+		if len(stats.SharingFiles) > 0 {
+			fmt.Println()
+		}
+	}
+	var ratio float64
+	if stats.DeduplicatedSizeBytes > 0 {
+		ratio = float64(stats.TotalSizeBytes) /
+			float64(stats.DeduplicatedSizeBytes)
+	}
+	fmt.Printf("Blocks: %d (%d distinct) of %s\n", stats.TotalBlocks,
+		stats.UniqueBlocks, formatSize(stats.BlockSize, true))
+	fmt.Printf("Size: %s, deduplicated: %s (ratio %.2f)\n",
+		formatSize(stats.TotalSizeBytes, true),
+		formatSize(stats.DeduplicatedSizeBytes, true), ratio)
+}
+
+// displayMissing displays the files missing from the reference tree
+func displayMissing(results Results, summaryOnly bool) {
+	if !summaryOnly {
+		for _, f := range results.Missing {
+			fmt.Println(f)
+		}
+	}
+	if myLog.verbosity < 1 && !summaryOnly {
+		return
+	}
+	myLog.Println(0, "Final count:", len(results.Missing),
+		"files missing from the reference")
+}
+
+// displayEqualTo displays the list of copies of the --equal-to file
+func displayEqualTo(results Results, summaryOnly bool) {
+	if !summaryOnly {
+		for _, f := range results.EqualTo {
+			fmt.Println(f)
+		}
+	}
+	if myLog.verbosity < 1 && !summaryOnly {
+		return
+	}
+	myLog.Println(0, "Final count:", len(results.EqualTo), "identical files")
+}
+
+// displayCaseCollisions displays the sets of paths differing only by case
+func displayCaseCollisions(results Results, summaryOnly bool) {
+	if !summaryOnly {
+		for i, c := range results.CaseCollisions {
+			fmt.Printf("\nCollision #%d (%d paths):\n", i+1, len(c))
+			for _, p := range c {
+				fmt.Println(p)
+			}
+		}
+	}
+
+	if myLog.verbosity < 1 && !summaryOnly {
+		return
+	}
+
+	if len(results.CaseCollisions) > 0 && myLog.verbosity > 0 {
+		fmt.Println()
+	}
+	myLog.Println(0, "Final count:", len(results.CaseCollisions),
+		"case collisions")
+}
+
+// displayDirGroups displays the groups of duplicate directories
+func displayDirGroups(results Results, summaryOnly bool) {
+	if !summaryOnly {
+		for i, g := range results.DirGroups {
+			fmt.Printf("\nDirectory group #%d (%d directories * %v):\n",
+				i+1, len(g.Paths), formatSize(g.Size, true))
+			for _, d := range g.Paths {
+				fmt.Println(d)
+			}
+		}
+	}
+
+	if myLog.verbosity < 1 && !summaryOnly {
+		return
+	}
+
+	if len(results.DirGroups) > 0 && myLog.verbosity > 0 {
+		fmt.Println()
+	}
+	myLog.Println(0, "Final count:", len(results.DirGroups),
+		"duplicate directory sets")
+}
+
+// displayManifestMatches displays the files matching manifest entries
+func displayManifestMatches(results Results, summaryOnly bool) {
+	var count int
+	for i, m := range results.ManifestMatches {
+		count += len(m.Paths)
+		if summaryOnly {
+			continue
+		}
+		fmt.Printf("\nMatch #%d (%s):\n", i+1, strings.Join(m.Entries, ", "))
+		for _, f := range m.Paths {
+			fmt.Println(f)
+		}
+	}
+
+	if myLog.verbosity < 1 && !summaryOnly {
+		return
+	}
+
+	if len(results.ManifestMatches) > 0 && myLog.verbosity > 0 {
+		fmt.Println()
+	}
+	myLog.Println(0, "Final count:", count, "files matching",
+		len(results.ManifestMatches), "manifest entries")
 }
 
 func displayResultsJSON(results Results) {
@@ -96,3 +578,35 @@ func displayResultsJSON(results Results) {
 	}
 	fmt.Println(string(b))
 }
+
+// ndjsonFile is the record used for the file-level JSON Lines output
+type ndjsonFile struct {
+	GroupID int       `json:"group_id"`
+	Size    uint64    `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Path    string    `json:"path"`
+	Hash    string    `json:"hash,omitempty"`
+
+	StableID string `json:"stable_id,omitempty"`
+}
+
+// displayResultsNDJSONFiles outputs one JSON object per duplicate file
+func displayResultsNDJSONFiles(results Results) {
+	enc := json.NewEncoder(os.Stdout)
+	for i, g := range results.Groups {
+		for j, f := range g.Paths {
+			rec := ndjsonFile{
+				GroupID: i + 1,
+				Size:    g.FileSize,
+				ModTime: g.ModTimes[j],
+				Path:    f,
+				Hash:    g.Hash,
+
+				StableID: g.StableID,
+			}
+			if err := enc.Encode(rec); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"flag"
+	"runtime/debug"
+	"strings"
+)
+
+// ScanParameters records how the results were produced (--record-parameters)
+type ScanParameters struct {
+	Version       string            `json:"version"`            // goduf version
+	Roots         []string          `json:"roots"`              // Scanned directories
+	HashAlgorithm string            `json:"hash_algorithm"`     // Full checksum algorithm
+	HashFor       map[string]string `json:"hash_for,omitempty"` // Algorithms by extension (--hash-for)
+	Flags         map[string]string `json:"flags,omitempty"`    // Command-line flags set
+}
+
+// toolVersion returns the goduf module version, if available.
+func toolVersion() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		return bi.Main.Version
+	}
+	return "unknown"
+}
+
+// scanParameters returns the parameters of the scan.
+func scanParameters(dirs []string) *ScanParameters {
+	params := &ScanParameters{
+		Version:       toolVersion(),
+		Roots:         dirs,
+		HashAlgorithm: "sha1",
+		Flags:         make(map[string]string),
+	}
+	if len(hashCommand) > 0 {
+		params.HashAlgorithm = "command: " + strings.Join(hashCommand, " ")
+	}
+	if len(extHashAlgorithms) > 0 {
+		params.HashFor = extHashAlgorithms
+	}
+	flag.Visit(func(f *flag.Flag) {
+		params.Flags[f.Name] = f.Value.String()
+	})
+	return params
+}
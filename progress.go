@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// progressInterval is the minimal delay between two progress messages
+const progressInterval = 5 * time.Second
+
+type progressT struct {
+	last          time.Time
+	enabled       bool // A pre-scan has been done (--two-pass)
+	expectedCount uint
+	expectedSize  uint64
+	scheduled     uint64 // Data to read for the scheduled checksums
+	hashed        uint64 // Data read so far for the scheduled checksums
+}
+
+// preScan walks the file trees once to count the regular files and their
+// total size, so that the progress of the actual scan and of the checksum
+// computation can be displayed.
+// Errors are ignored here, they will be reported by the real walk.
+func (p *progressT) preScan(dirs []string, walk func(string, filepath.WalkFunc) error) {
+	count := func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			if f != nil && f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if f.Mode().IsRegular() {
+			p.expectedCount++
+			p.expectedSize += uint64(f.Size())
+		}
+		return nil
+	}
+	for _, root := range dirs {
+		walk(root, count)
+	}
+	p.enabled = true
+}
+
+// start resets the progress timer.
+func (p *progressT) start() {
+	p.last = time.Now()
+}
+
+// walkProgress periodically displays the number of files scanned so far.
+// If a pre-scan has been done, the expected number of files is displayed
+// as well.
+func (p *progressT) walkProgress(count uint) {
+	if count%256 != 0 || time.Since(p.last) < progressInterval {
+		return
+	}
+	p.last = time.Now()
+	if p.enabled {
+		myLog.Printf(1, "  Scanned %d/%d files so far\n",
+			count, p.expectedCount)
+		return
+	}
+	myLog.Printf(1, "  Scanned %d files so far\n", count)
+}
+
+// scheduledBytes returns the amount of data to read to compute the
+// scheduled checksum of the file.
+func (fo *fileObj) scheduledBytes() uint64 {
+	switch fo.needHash {
+	case fullChecksum:
+		return uint64(fo.Size())
+	case partialChecksum:
+		if partialCDC {
+			return (2 + cdcSamples) * medsumBytes
+		}
+		return 2 * medsumBytes
+	}
+	return 0
+}
+
+// startHashing sets the amount of data to read for the scheduled
+// checksums.
+func (p *progressT) startHashing(total uint64) {
+	p.scheduled, p.hashed = total, 0
+	p.last = time.Now()
+}
+
+// hashProgress records the checksum computation of n bytes of scheduled
+// data, and periodically displays the percentage of the scheduled data
+// hashed so far if a pre-scan has been done.
+func (p *progressT) hashProgress(n uint64) {
+	p.hashed += n
+	if !p.enabled || p.scheduled == 0 ||
+		time.Since(p.last) < progressInterval {
+		return
+	}
+	p.last = time.Now()
+	myLog.Printf(1, "  Hashed %s of %s so far (%d%%)\n",
+		formatSize(p.hashed, true), formatSize(p.scheduled, true),
+		p.hashed*100/p.scheduled)
+}
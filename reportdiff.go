@@ -0,0 +1,239 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ReportDiff contains the differences between two saved JSON reports
+// (--diff-reports)
+type ReportDiff struct {
+	New      []ResultSet   `json:"new,omitempty"`      // Groups only in the second report
+	Resolved []ResultSet   `json:"resolved,omitempty"` // Groups only in the first report
+	Changed  []GroupChange `json:"changed,omitempty"`  // Groups whose files changed
+
+	RedundantBefore uint64 `json:"redundant_data_size_before"` // Redundant data size (first report)
+	RedundantAfter  uint64 `json:"redundant_data_size_after"`  // Redundant data size (second report)
+}
+
+// GroupChange lists the files added to or removed from a duplicate group
+type GroupChange struct {
+	StableID string   `json:"stable_id,omitempty"`
+	FileSize uint64   `json:"file_size"`
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// loadReport reads a Results JSON document saved with --json.
+func loadReport(filename string) (Results, error) {
+	var results Results
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return results, err
+	}
+	if err := json.Unmarshal(b, &results); err != nil {
+		return results, fmt.Errorf("%s: %v", filename, err)
+	}
+	for i, g := range results.Groups {
+		if g.Base == "" {
+			continue
+		}
+		// Restore the full paths (--json-compact-paths)
+		for j, p := range g.Paths {
+			g.Paths[j] = filepath.Join(g.Base, p)
+		}
+		results.Groups[i].Base = ""
+	}
+	return results, nil
+}
+
+// sharesPath returns true if the groups have at least a file in common.
+func sharesPath(a, b ResultSet) bool {
+	paths := make(map[string]bool)
+	for _, p := range a.Paths {
+		paths[p] = true
+	}
+	for _, p := range b.Paths {
+		if paths[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// pathChanges returns the paths of after missing from before, and the
+// paths of before missing from after.
+func pathChanges(before, after []string) (added, removed []string) {
+	inBefore := make(map[string]bool)
+	for _, p := range before {
+		inBefore[p] = true
+	}
+	inAfter := make(map[string]bool)
+	for _, p := range after {
+		inAfter[p] = true
+		if !inBefore[p] {
+			added = append(added, p)
+		}
+	}
+	for _, p := range before {
+		if !inAfter[p] {
+			removed = append(removed, p)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return pathLess(added[i], added[j]) })
+	sort.Slice(removed, func(i, j int) bool { return pathLess(removed[i], removed[j]) })
+	return added, removed
+}
+
+// diffReports compares two reports.  The groups are matched with their
+// stable ID (--stable-ids); groups without ID are matched with a group of
+// the same file size sharing at least one path.
+func diffReports(before, after Results) ReportDiff {
+	diff := ReportDiff{
+		RedundantBefore: before.RedundantDataSizeBytes,
+		RedundantAfter:  after.RedundantDataSizeBytes,
+	}
+
+	byID := make(map[string]int)
+	for i, g := range before.Groups {
+		if g.StableID != "" {
+			byID[g.StableID] = i
+		}
+	}
+	matched := make([]bool, len(before.Groups))
+	var unmatched []ResultSet
+	compare := func(b, a ResultSet) {
+		added, removed := pathChanges(b.Paths, a.Paths)
+		if len(added) == 0 && len(removed) == 0 {
+			return
+		}
+		diff.Changed = append(diff.Changed, GroupChange{
+			StableID: a.StableID,
+			FileSize: a.FileSize,
+			Added:    added,
+			Removed:  removed,
+		})
+	}
+
+	for _, g := range after.Groups {
+		if i, ok := byID[g.StableID]; ok && !matched[i] {
+			matched[i] = true
+			compare(before.Groups[i], g)
+			continue
+		}
+		unmatched = append(unmatched, g)
+	}
+	for _, g := range unmatched {
+		var found bool
+		for i, b := range before.Groups {
+			if matched[i] || b.FileSize != g.FileSize || !sharesPath(b, g) {
+				continue
+			}
+			if b.StableID != "" && g.StableID != "" {
+				continue // Different contents
+			}
+			matched[i], found = true, true
+			compare(b, g)
+			break
+		}
+		if !found {
+			diff.New = append(diff.New, g)
+		}
+	}
+	for i, b := range before.Groups {
+		if !matched[i] {
+			diff.Resolved = append(diff.Resolved, b)
+		}
+	}
+	return diff
+}
+
+// displayReportDiff prints the differences between two reports.
+func displayReportDiff(diff ReportDiff) {
+	header := func(kind string, g ResultSet) {
+		var id string
+		if g.StableID != "" {
+			id = " [" + g.StableID + "]"
+		}
+		fmt.Printf("\n%s group%s (%d files * %v):\n", kind, id,
+			len(g.Paths), formatSize(g.FileSize, true))
+	}
+	for _, g := range diff.New {
+		header("New", g)
+		for _, p := range g.Paths {
+			fmt.Println(p)
+		}
+	}
+	for _, g := range diff.Resolved {
+		header("Resolved", g)
+		for _, p := range g.Paths {
+			fmt.Println(p)
+		}
+	}
+	for _, c := range diff.Changed {
+		var id string
+		if c.StableID != "" {
+			id = " [" + c.StableID + "]"
+		}
+		fmt.Printf("\nChanged group%s (%v):\n", id, formatSize(c.FileSize, true))
+		for _, p := range c.Added {
+			fmt.Println("+", p)
+		}
+		for _, p := range c.Removed {
+			fmt.Println("-", p)
+		}
+	}
+
+	fmt.Println()
+	myLog.Println(0, "Changes:", len(diff.New), "new groups,",
+		len(diff.Resolved), "resolved groups,", len(diff.Changed),
+		"changed groups")
+	myLog.Printf(0, "Redundant data size: %v -> %v\n",
+		formatSize(diff.RedundantBefore, true),
+		formatSize(diff.RedundantAfter, true))
+}
+
+// compareReports loads two JSON reports and displays their differences.
+func compareReports(before, after string, toJSON bool) error {
+	r1, err := loadReport(before)
+	if err != nil {
+		return err
+	}
+	r2, err := loadReport(after)
+	if err != nil {
+		return err
+	}
+	diff := diffReports(r1, r2)
+	if !toJSON {
+		displayReportDiff(diff)
+		return nil
+	}
+	b, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// readRetries is the number of times a checksum computation is retried
+// after a transient read error
+var readRetries uint
+
+// readRetryDelay is the delay before the first retry; it is doubled
+// after every attempt.
+const readRetryDelay = 100 * time.Millisecond
+
+// isTransientError returns true if the error may go away if the read is
+// attempted again (e.g. on network filesystems).
+func isTransientError(err error) bool {
+	// A file which has timed out (--read-timeout) is not read again,
+	// because its previous read may still be blocked.
+	if isReadTimeout(err) {
+		return false
+	}
+	for _, e := range transientErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return os.IsTimeout(err)
+}
+
+// sumWithRetries calls sum, retrying with an exponential backoff when a
+// transient error occurs.
+func (fo *fileObj) sumWithRetries(sType sumType, sum func(sumType) error) error {
+	delay := readRetryDelay
+	for attempt := uint(1); ; attempt++ {
+		err := sum(sType)
+		if err == nil || attempt > readRetries || !isTransientError(err) {
+			return err
+		}
+		myLog.Printf(1, "Read error (attempt %d), retrying in %v: %v\n",
+			attempt, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
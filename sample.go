@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import "math/rand"
+
+// sampler randomly selects a fraction of the scanned files (--sample-rate).
+type sampler struct {
+	rate    float64
+	rng     *rand.Rand
+	skipped uint
+}
+
+func newSampler(rate float64, seed int64) *sampler {
+	return &sampler{rate: rate, rng: rand.New(rand.NewSource(seed))}
+}
+
+// keep returns true if the next file should be part of the sample.
+func (s *sampler) keep() bool {
+	if s.rng.Float64() < s.rate {
+		return true
+	}
+	s.skipped++
+	return false
+}
+
+// SampleEstimate contains figures extrapolated from a sampled scan.
+// The values are simply scaled by the inverse of the sampling rate, so
+// they are rough estimates; duplicates with few copies are likely to be
+// underestimated, since both copies need to be part of the sample.
+type SampleEstimate struct {
+	Rate                   float64 `json:"rate"`
+	Duplicates             uint    `json:"duplicates"`
+	RedundantDataSizeBytes uint64  `json:"redundant_data_size_bytes"`
+	TotalFileCount         uint    `json:"total_file_count"`
+	TotalSizeBytes         uint64  `json:"total_size_bytes"`
+}
+
+// estimate extrapolates the results of a sampled scan.
+func (results Results) estimate(rate float64) *SampleEstimate {
+	return &SampleEstimate{
+		Rate:                   rate,
+		Duplicates:             uint(float64(results.Duplicates) / rate),
+		RedundantDataSizeBytes: uint64(float64(results.RedundantDataSizeBytes) / rate),
+		TotalFileCount:         uint(float64(results.TotalFileCount) / rate),
+		TotalSizeBytes:         uint64(float64(results.TotalSizeBytes) / rate),
+	}
+}
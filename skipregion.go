@@ -0,0 +1,35 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+// skipHeader and skipFooter are the sizes of the regions at the start and
+// at the end of the files which are excluded from the full checksums
+// (--skip-header, --skip-footer)
+var skipHeader, skipFooter int64
+
+// hashedRegion returns the offset and length of the part of a file of the
+// given size which is used for the full checksum.
+// Files which are not larger than the skipped regions are hashed entirely.
+func hashedRegion(size int64) (offset, length int64) {
+	if skipHeader+skipFooter >= size {
+		return 0, size
+	}
+	return skipHeader, size - skipHeader - skipFooter
+}
@@ -19,6 +19,54 @@
 
 package main
 
+import (
+	"sort"
+
+	"golang.org/x/text/collate"
+)
+
+// pathCollator is used to sort paths according to a locale, if set
+var pathCollator *collate.Collator
+
+// pathLess compares two paths, using the locale collator if one is set.
+// Byte order is used by default, and to break ties.
+func pathLess(a, b string) bool {
+	if pathCollator != nil {
+		if c := pathCollator.CompareString(a, b); c != 0 {
+			return c < 0
+		}
+	}
+	return a < b
+}
+
+// fileLess compares two files by path, then by device and inode IDs,
+// so that the order is total and does not depend on the scan order.
+func fileLess(a, b *fileObj) bool {
+	if a.FilePath != b.FilePath {
+		return pathLess(a.FilePath, b.FilePath)
+	}
+	devA, inoA := GetDevIno(a)
+	devB, inoB := GetDevIno(b)
+	if devA != devB {
+		return devA < devB
+	}
+	return inoA < inoB
+}
+
+// groupLess compares two groups of files by their paths.
+// The groups are expected to be sorted.
+func groupLess(a, b FileObjList) bool {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if fileLess(a[k], b[k]) {
+			return true
+		}
+		if fileLess(b[k], a[k]) {
+			return false
+		}
+	}
+	return len(a) < len(b)
+}
+
 // Implement a sort interface for the list of duplicate groups
 type byGroupFileSize foListList
 
@@ -28,16 +76,75 @@ func (a byGroupFileSize) Less(i, j int) bool {
 	// Since this is supposed to be used for duplicate lists,
 	// we use the size of the first file of the group.
 	if a[i][0].Size() == a[j][0].Size() {
-		return a[i][0].FilePath < a[j][0].FilePath
+		return groupLess(a[i], a[j])
 	}
 	return a[i][0].Size() < a[j][0].Size()
 }
 
+// byGroupWaste sorts duplicate lists by decreasing redundant size
+type byGroupWaste foListList
+
+func (a byGroupWaste) Len() int      { return len(a) }
+func (a byGroupWaste) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byGroupWaste) Less(i, j int) bool {
+	wi := a[i][0].Size() * int64(len(a[i])-1)
+	wj := a[j][0].Size() * int64(len(a[j])-1)
+	if wi == wj {
+		return groupLess(a[i], a[j])
+	}
+	return wi > wj
+}
+
 // Implement a sort interface for a slice of files
 type byFilePathName FileObjList
 
 func (a byFilePathName) Len() int      { return len(a) }
 func (a byFilePathName) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a byFilePathName) Less(i, j int) bool {
-	return a[i].FilePath < a[j].FilePath
+	return fileLess(a[i], a[j])
+}
+
+// byFileModTime sorts files by modification time, oldest first
+type byFileModTime FileObjList
+
+func (a byFileModTime) Len() int      { return len(a) }
+func (a byFileModTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byFileModTime) Less(i, j int) bool {
+	if a[i].ModTime().Equal(a[j].ModTime()) {
+		return fileLess(a[i], a[j])
+	}
+	return a[i].ModTime().Before(a[j].ModTime())
+}
+
+// Group member orders (--group-member-sort)
+const (
+	memberSortPath      = "path"
+	memberSortMtime     = "mtime"
+	memberSortNewest    = "newest"
+	memberSortKeepFirst = "keep-first"
+)
+
+// sortGroupMembers sorts the files of a duplicate group.
+// If keep is not nil, the file it returns (the file to keep) is moved to
+// the front of the list.
+func sortGroupMembers(l FileObjList, order string, keep func(FileObjList) *fileObj) {
+	switch order {
+	case memberSortMtime:
+		sort.Sort(byFileModTime(l))
+	case memberSortNewest:
+		sort.Sort(sort.Reverse(byFileModTime(l)))
+	default:
+		sort.Sort(byFilePathName(l))
+	}
+	if keep == nil {
+		return
+	}
+	first := keep(l)
+	for i, fo := range l {
+		if fo == first {
+			copy(l[1:i+1], l[:i])
+			l[0] = first
+			break
+		}
+	}
 }
@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"io"
+	"os"
+)
+
+// sparseFiles enables the hole-aware full checksums
+var sparseFiles bool
+
+// Extent record types for sparse checksums
+const (
+	extentData byte = 'D'
+	extentHole byte = 'H'
+)
+
+// writeExtentHeader adds an extent record header to the hash.
+func writeExtentHeader(h hash.Hash, kind byte, length int64) {
+	var hdr [9]byte
+	hdr[0] = kind
+	binary.BigEndian.PutUint64(hdr[1:], uint64(length))
+	h.Write(hdr[:])
+}
+
+// hashDataExtent adds a data extent record and its content to the hash.
+func (fo *fileObj) hashDataExtent(h hash.Hash, file *os.File, offset, length int64) (int64, error) {
+	writeExtentHeader(h, extentData, length)
+	section := io.NewSectionReader(file, offset, length)
+	return io.CopyN(h, fo.reader(section), length)
+}
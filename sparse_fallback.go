@@ -0,0 +1,32 @@
+// Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software
+// Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+// USA
+
+//go:build !linux && !freebsd
+
+package main
+
+import (
+	"hash"
+	"os"
+)
+
+// sparseHash hashes the whole file as a single data extent, since holes
+// cannot be detected on this system.
+func (fo *fileObj) sparseHash(h hash.Hash, file *os.File) (int64, int64, error) {
+	n, err := fo.hashDataExtent(h, file, 0, fo.Size())
+	return n, n, err
+}
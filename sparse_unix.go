@@ -0,0 +1,66 @@
+// Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software
+// Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+// USA
+
+//go:build linux || freebsd
+
+package main
+
+import (
+	"hash"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// sparseHash hashes the file layout: data extents are read and hashed,
+// and holes are only recorded with their length.
+// It returns the number of bytes covered and the number of bytes read.
+func (fo *fileObj) sparseHash(h hash.Hash, file *os.File) (int64, int64, error) {
+	size := fo.Size()
+	fd := int(file.Fd())
+	var offset, read int64
+	for offset < size {
+		data, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			data = size // No more data: trailing hole
+		} else if err != nil {
+			return offset, read, err
+		}
+		if data > size {
+			data = size
+		}
+		if data > offset {
+			writeExtentHeader(h, extentHole, data-offset)
+			offset = data
+			continue
+		}
+		hole, err := unix.Seek(fd, offset, unix.SEEK_HOLE)
+		if err != nil {
+			return offset, read, err
+		}
+		if hole > size || hole <= offset {
+			hole = size
+		}
+		n, err := fo.hashDataExtent(h, file, offset, hole-offset)
+		read += n
+		offset += n
+		if err != nil {
+			return offset, read, err
+		}
+	}
+	return offset, read, nil
+}
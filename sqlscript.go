@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const sqlSchema = `CREATE TABLE groups (
+	id INTEGER PRIMARY KEY,
+	file_size INTEGER NOT NULL,
+	file_count INTEGER NOT NULL,
+	redundant_size INTEGER NOT NULL
+);
+CREATE TABLE files (
+	group_id INTEGER NOT NULL REFERENCES groups(id),
+	path TEXT NOT NULL,
+	dir TEXT NOT NULL,
+	name TEXT NOT NULL,
+	extension TEXT NOT NULL,
+	mtime INTEGER,
+	hard_link_of TEXT
+);
+CREATE INDEX files_group_id ON files(group_id);
+`
+
+// sqlQuote returns s as an SQL string literal.
+func sqlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// sqlFileRow returns the values of a files table row.
+func sqlFileRow(groupID int, path string, mtime string, linkOf string) string {
+	return fmt.Sprintf("(%d, %s, %s, %s, %s, %s, %s)", groupID,
+		sqlQuote(path), sqlQuote(filepath.Dir(path)),
+		sqlQuote(filepath.Base(path)),
+		sqlQuote(strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))),
+		mtime, linkOf)
+}
+
+// writeSQLScript writes the duplicate groups as an SQL script creating and
+// filling "groups" and "files" tables, suitable for SQLite
+// (e.g. "sqlite3 dupes.db < dupes.sql").
+func writeSQLScript(results Results, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "-- Duplicate files generated by goduf")
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+	fmt.Fprint(w, sqlSchema)
+	for i, g := range results.Groups {
+		id := i + 1
+		fmt.Fprintf(w, "INSERT INTO groups VALUES (%d, %d, %d, %d);\n", id,
+			g.FileSize, len(g.Paths), g.FileSize*uint64(len(g.Paths)-1))
+		for j, p := range g.Paths {
+			mtime := "NULL"
+			if j < len(g.ModTimes) {
+				mtime = fmt.Sprint(g.ModTimes[j].Unix())
+			}
+			fmt.Fprintf(w, "INSERT INTO files VALUES %s;\n",
+				sqlFileRow(id, p, mtime, "NULL"))
+			for _, l := range g.Links[p] {
+				fmt.Fprintf(w, "INSERT INTO files VALUES %s;\n",
+					sqlFileRow(id, l, mtime, sqlQuote(p)))
+			}
+		}
+	}
+	fmt.Fprintln(w, "COMMIT;")
+
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
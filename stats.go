@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// statsCategories lists the statistics categories available for --stats
+var statsCategories = []string{"walk", "cleanup", "hashing", "io"}
+
+// statsSelection is a flag.Value for the list of statistics categories
+// to display, e.g. "walk,io".  Categories prefixed with '-' are removed
+// from the selection, which starts with all categories if the first one
+// is a removal.
+type statsSelection map[string]bool
+
+// selectedStats contains the --stats selection (nil if not set)
+var selectedStats statsSelection
+
+func (s *statsSelection) String() string {
+	var list []string
+	for _, c := range statsCategories {
+		if (*s)[c] {
+			list = append(list, c)
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+func (s *statsSelection) Set(value string) error {
+	selection := make(statsSelection)
+	for i, c := range strings.Split(value, ",") {
+		remove := strings.HasPrefix(c, "-")
+		c = strings.TrimPrefix(c, "-")
+		if i == 0 && remove {
+			for _, all := range statsCategories {
+				selection[all] = true
+			}
+		}
+		var known bool
+		for _, k := range statsCategories {
+			if c == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errors.New("unknown statistics category: " + c)
+		}
+		selection[c] = !remove
+	}
+	*s = selection
+	return nil
+}
+
+// statsWanted returns true if the statistics of the category are
+// displayed.
+func statsWanted(category string) bool {
+	if selectedStats == nil {
+		return myLog.verbosity > 0
+	}
+	return selectedStats[category]
+}
+
+// statsLog displays a statistics message of the category.  Without a
+// --stats selection, the message is displayed according to its level;
+// otherwise it is displayed if and only if its category is selected.
+func statsLog(category string, level int, format string, args ...interface{}) {
+	if selectedStats == nil {
+		myLog.Printf(level, format, args...)
+		return
+	}
+	if selectedStats[category] {
+		myLog.Printf(0, format, args...)
+	}
+}
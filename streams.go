@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"io"
+	"os"
+)
+
+// includeStreams enables the hashing of named streams (--include-streams)
+var includeStreams bool
+
+// namedStream is an additional data stream of a file (resource fork,
+// alternate data stream)
+type namedStream struct {
+	name string // Stream name
+	path string // Path used to open the stream
+}
+
+// hashNamedStreams adds the named streams of the file to the hash.
+// It returns the number of bytes read.
+func (fo *fileObj) hashNamedStreams(h hash.Hash) (int64, error) {
+	streams, err := namedStreams(fo.FilePath)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, s := range streams {
+		file, err := os.Open(s.path)
+		if err != nil {
+			return total, err
+		}
+		var hdr [8]byte
+		h.Write([]byte("\x00stream:" + s.name + "\x00"))
+		n, err := io.Copy(h, fo.reader(file))
+		file.Close()
+		total += n
+		if err != nil {
+			return total, err
+		}
+		binary.BigEndian.PutUint64(hdr[:], uint64(n))
+		h.Write(hdr[:])
+	}
+	return total, nil
+}
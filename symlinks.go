@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// canonicalPath returns the absolute path of the file, with symbolic
+// links resolved.
+func canonicalPath(path string) (string, error) {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(realPath)
+}
+
+// addSymlink records a symbolic link by target (--note-symlinks).
+func (data *dataT) addSymlink(path string) {
+	target, err := canonicalPath(path)
+	if err != nil {
+		myLog.Println(5, "Cannot resolve symbolic link:", err)
+		return
+	}
+	data.symlinks[target] = append(data.symlinks[target], path)
+}
+
+// symlinksTo returns the recorded symbolic links pointing to the file.
+func (data *dataT) symlinksTo(path string) []string {
+	target, err := canonicalPath(path)
+	if err != nil {
+		return nil
+	}
+	links := data.symlinks[target]
+	sort.Slice(links, func(i, j int) bool {
+		return pathLess(links[i], links[j])
+	})
+	return links
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits the aggregate throughput of several readers.
+// Every read reserves a time slot proportional to its size; the reader
+// waits until its slot begins.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64   // Bytes per second
+	next time.Time // Beginning of the next free slot
+}
+
+// readLimiter is the limiter shared by all the file reads (nil if there
+// is no limit).
+var readLimiter *rateLimiter
+
+func newRateLimiter(bytesPerSecond uint64) *rateLimiter {
+	return &rateLimiter{rate: float64(bytesPerSecond)}
+}
+
+// wait blocks until n more bytes can be read.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+type throttledReader struct {
+	r io.Reader
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	readLimiter.wait(n)
+	return n, err
+}
+
+// throttle returns a reader limited by readLimiter, if it is set.
+func throttle(r io.Reader) io.Reader {
+	if readLimiter == nil {
+		return r
+	}
+	return throttledReader{r}
+}
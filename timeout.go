@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// readTimeout is the maximum duration of a checksum computation (0 for
+// no limit)
+var readTimeout time.Duration
+
+// timedOutFiles is the list of files for which the checksum computation
+// has timed out.  It is protected by timedOutMutex, because the files are
+// compared concurrently (--stream-compare).
+var timedOutFiles []string
+var timedOutMutex sync.Mutex
+
+// readTimeoutError is returned when a checksum computation has been given
+// up after readTimeout
+type readTimeoutError struct {
+	path string
+}
+
+func (e *readTimeoutError) Error() string { return "read timeout: " + e.path }
+func (e *readTimeoutError) Timeout() bool { return true }
+
+// timedOutList returns the files which have timed out, without repetition.
+func timedOutList() []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, f := range timedOutFiles {
+		if !seen[f] {
+			seen[f] = true
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// errReadAborted is returned by the reads of a checksum computation which
+// has been given up
+var errReadAborted = errors.New("read aborted")
+
+// abortableReader fails once the abort channel is closed, so that a
+// checksum computation which has timed out stops at the next read.
+type abortableReader struct {
+	r     io.Reader
+	abort <-chan struct{}
+}
+
+func (a abortableReader) Read(p []byte) (int, error) {
+	select {
+	case <-a.abort:
+		return 0, errReadAborted
+	default:
+	}
+	return a.r.Read(p)
+}
+
+// reader returns the reader used to compute the checksums of the file.
+func (fo *fileObj) reader(r io.Reader) io.Reader {
+	r = throttle(r)
+	if fo.abort != nil {
+		r = abortableReader{r, fo.abort}
+	}
+	return r
+}
+
+// withTimeout calls read in a separate goroutine and gives up after
+// readTimeout.
+// The read is done on a copy of the file object, because a blocked read
+// cannot be interrupted and the goroutine could update the file object
+// later; the following reads of the copy fail.  The read function must not
+// update shared data after a timeout.
+// Files which have timed out are not read again.
+func (fo *fileObj) withTimeout(read func(*fileObj) error) error {
+	if fo.timedOut {
+		return &readTimeoutError{fo.FilePath}
+	}
+	if readTimeout == 0 {
+		return read(fo)
+	}
+	c := make(chan error, 1)
+	abort := make(chan struct{})
+	tmp := *fo
+	tmp.abort = abort
+	go func() {
+		c <- read(&tmp)
+	}()
+
+	select {
+	case err := <-c:
+		return err
+	case <-time.After(readTimeout):
+		close(abort)
+		fo.timedOut = true
+		timedOutMutex.Lock()
+		timedOutFiles = append(timedOutFiles, fo.FilePath)
+		timedOutMutex.Unlock()
+		return &readTimeoutError{fo.FilePath}
+	}
+}
+
+// readContents calls read with the in-flight tracking, the timeout
+// (--read-timeout) and the retries (--read-retries) used for all the
+// reads of file contents.  The read function gets the file object to use
+// (see withTimeout); sType describes the read.
+func (fo *fileObj) readContents(sType sumType, read func(*fileObj) error) error {
+	inFlight.begin(fo.FilePath, sType)
+	defer inFlight.end(fo.FilePath)
+	attempt := func(sumType) error {
+		return fo.withTimeout(read)
+	}
+	if readRetries > 0 {
+		return fo.sumWithRetries(sType, attempt)
+	}
+	return attempt(sType)
+}
+
+// isReadTimeout returns true if the error is a read timeout.
+func isReadTimeout(err error) bool {
+	var timeoutErr *readTimeoutError
+	return errors.As(err, &timeoutErr)
+}
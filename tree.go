@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dirNode is a directory of the duplicates tree
+type dirNode struct {
+	name      string
+	children  map[string]*dirNode
+	direct    uint   // Number of duplicates in this directory
+	files     uint   // Number of duplicates in this subtree
+	redundant uint64 // Redundant data size in this subtree
+}
+
+func newDirNode(name string) *dirNode {
+	return &dirNode{name: name, children: make(map[string]*dirNode)}
+}
+
+// splitPath returns the components of a directory path.
+// The root directory of an absolute path is kept as the first component.
+func splitPath(dir string) []string {
+	dir = filepath.Clean(dir)
+	sep := string(filepath.Separator)
+	vol := filepath.VolumeName(dir)
+	dir = dir[len(vol):]
+	var components []string
+	if strings.HasPrefix(dir, sep) {
+		components = append(components, vol+sep)
+		dir = dir[1:]
+	} else if vol != "" {
+		components = append(components, vol)
+	}
+	if dir != "" && dir != "." {
+		components = append(components, strings.Split(dir, sep)...)
+	}
+	return components
+}
+
+// commonDir returns the longest common directory of the paths, or an
+// empty string if there is none.
+func commonDir(paths []string) string {
+	var common []string
+	for i, p := range paths {
+		components := splitPath(filepath.Dir(p))
+		if i == 0 {
+			common = components
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(components) && common[n] == components[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 0 {
+		return ""
+	}
+	return filepath.Join(common...)
+}
+
+// buildDirTree builds the directory tree of the duplicate files.
+// The first file of each group is not counted as redundant.
+func buildDirTree(groups []ResultSet) *dirNode {
+	root := newDirNode("")
+	for _, g := range groups {
+		for i, p := range g.Paths {
+			node := root
+			node.files++
+			if i > 0 {
+				node.redundant += g.FileSize
+			}
+			for _, c := range splitPath(filepath.Dir(p)) {
+				child, ok := node.children[c]
+				if !ok {
+					child = newDirNode(c)
+					node.children[c] = child
+				}
+				node = child
+				node.files++
+				if i > 0 {
+					node.redundant += g.FileSize
+				}
+			}
+			node.direct++
+		}
+	}
+	return root
+}
+
+// display prints the subtree, collapsing the directories with a single
+// subdirectory and no duplicates.
+func (node *dirNode) display(depth int) {
+	name := node.name
+	for len(node.children) == 1 && node.direct == 0 {
+		for _, child := range node.children {
+			node = child
+		}
+		name = filepath.Join(name, node.name)
+	}
+	fmt.Printf("%s%s (%d files, %s redundant)\n", strings.Repeat("  ", depth),
+		name, node.files, formatSize(node.redundant, true))
+
+	for _, child := range node.sortedChildren() {
+		child.display(depth + 1)
+	}
+}
+
+// sortedChildren returns the subdirectories sorted by name.
+func (node *dirNode) sortedChildren() []*dirNode {
+	var children []*dirNode
+	for _, child := range node.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return pathLess(children[i].name, children[j].name)
+	})
+	return children
+}
+
+// displayTree displays the duplicates as a directory tree, with the
+// number of duplicate files and the redundant data size of each subtree
+func displayTree(results Results) {
+	root := buildDirTree(results.Groups)
+	for _, child := range root.sortedChildren() {
+		child.display(0)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// parseSize converts a human-readable size (e.g. "100", "20K", "1.5GiB")
+// to a number of bytes.  Multiples of 1024 are used for the units.
+func parseSize(s string) (uint64, error) {
+	var units = []string{"K", "M", "G", "T", "P"}
+
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	str = strings.TrimSuffix(str, "I")
+	multiplier := 1.0
+	for i, u := range units {
+		if strings.HasSuffix(str, u) {
+			str = strings.TrimSuffix(str, u)
+			for ; i >= 0; i-- {
+				multiplier *= 1024
+			}
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size: " + s)
+	}
+	return uint64(n * multiplier), nil
+}
+
+// sizeValue is a flag.Value for human-readable sizes.
+type sizeValue uint64
+
+func (v *sizeValue) String() string {
+	if v == nil || *v == 0 {
+		return ""
+	}
+	return formatSize(uint64(*v), true)
+}
+
+func (v *sizeValue) Set(s string) error {
+	n, err := parseSize(s)
+	if err != nil {
+		return err
+	}
+	*v = sizeValue(n)
+	return nil
+}
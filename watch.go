@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2014-2022 Mikael Berthe <mikael@lilotux.net>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place, Suite 330, Boston, MA 02111-1307
+ * USA
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// treeFingerprint returns a checksum of the metadata of the trees, used
+// to detect changes in --watch mode.
+func treeFingerprint(dirs []string) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, root := range dirs {
+		filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			h.Write([]byte(path))
+			for _, v := range []int64{f.Size(), f.ModTime().UnixNano(), int64(f.Mode())} {
+				binary.LittleEndian.PutUint64(buf, uint64(v))
+				h.Write(buf)
+			}
+			return nil
+		})
+	}
+	return h.Sum64()
+}
+
+// watch polls the trees and calls run again every time they change.
+// It never returns.
+func watch(dirs []string, interval time.Duration, run func()) {
+	last := treeFingerprint(dirs)
+	run()
+	for {
+		time.Sleep(interval)
+		fp := treeFingerprint(dirs)
+		if fp == last {
+			continue
+		}
+		last = fp
+		myLog.Println(0, "* Changes detected, scanning again")
+		run()
+	}
+}